@@ -0,0 +1,3 @@
+module github.com/beacham/go_client
+
+go 1.21
@@ -0,0 +1,366 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+)
+
+/*
+ * Format of get alarm request, assumed: no sample of it is documented, this is
+ * the shape of the other get requests. It lists the alarms the device currently
+ * holds.
+ *
+ * <request id="C1004" origin="transcoder-collector" destination="device" command="get" category="alarm"
+ * time="2017-08-30T16:24:54.900-07:00" protocol-version="2.1" platform-name="neo" sid="949098745790">
+ * <path>
+ * <farmer id="ME-7000-2"/>
+ * </path>
+ * </request>
+ *
+ * Format of get alarm response, assumed as well, with the attributes of the
+ * alarm events: an alarm that has been cleared but not deleted has a cleared-time.
+ *
+ * <response id="C1004" origin="device" destination="transcoder-collector" command="get" category="alarm"
+ * time="2017-08-30T23:24:54.900Z" protocol-version="2.1" platform-name="neo" sw-version="me7k.2.1.2" sw-build="0">
+ * <alarm-list>
+ * <alarm id="1435316297245" severity="major" description="Input loss" time="2015-06-26T10:58:17.245Z"/>
+ * <alarm id="1435265291353" severity="minor" description="Fan speed" time="2015-06-25T20:48:11.353Z"
+ * cleared-time="2015-06-26T16:38:02.513Z"/>
+ * </alarm-list>
+ * </response>
+ */
+
+type AlarmsRequest struct {
+    XMLName xml.Name `xml:"request"`
+    Envelope
+    Path Path `xml:"path"` // the farmer only
+}
+
+type AlarmsResponse struct {
+    XMLName xml.Name `xml:"response"`
+    ResponseEnvelope
+    Alarms []AlarmEntry `xml:"alarm-list>alarm"`
+}
+
+type AlarmEntry struct {
+    XMLName     xml.Name `xml:"alarm"`
+    Id          string   `xml:"id,attr"`
+    Severity    string   `xml:"severity,attr"`
+    Description string   `xml:"description,attr,omitempty"`
+    Time        string   `xml:"time,attr,omitempty"`
+    ClearedTime string   `xml:"cleared-time,attr,omitempty"`
+}
+
+//
+// Alarm is the state of one alarm of a device. Cleared is zero while the
+// alarm is active.
+//
+
+type Alarm struct {
+    Farmer      string
+    Id          string
+    Severity    string
+    Description string
+    Raised      time.Time
+    Cleared     time.Time
+}
+
+func (a Alarm) Active() bool {
+    return a.Cleared.IsZero()
+}
+
+//
+// Alarms returns the alarms farmer currently holds, active or cleared.
+//
+
+func (c *Client) Alarms(ctx context.Context, farmer string) ([]Alarm, error) {
+    v := &AlarmsRequest{Envelope: c.envelope("get", "alarm"), Path: NewPath(farmer)}
+
+    rsp := AlarmsResponse{}
+    if err := c.call(ctx, "Alarms", v, &rsp); err != nil {
+        return nil, err
+    }
+
+    alarms := make([]Alarm, 0, len(rsp.Alarms))
+    for _, e := range rsp.Alarms {
+        a := Alarm{Farmer: farmer, Id: e.Id, Severity: e.Severity, Description: e.Description}
+        var err error
+        if e.Time != "" {
+            a.Raised, err = ParseTime(e.Time)
+        } else {
+            a.Raised, err = EventIdTime(e.Id)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("Alarms - alarm %s: %v", e.Id, err)
+        }
+        if e.ClearedTime != "" {
+            if a.Cleared, err = ParseTime(e.ClearedTime); err != nil {
+                return nil, fmt.Errorf("Alarms - alarm %s: %v", e.Id, err)
+            }
+        }
+        alarms = append(alarms, a)
+    }
+    return alarms, nil
+}
+
+type AlarmChangeKind int
+
+const (
+    AlarmChangeRaised  AlarmChangeKind = iota // new active alarm, from an event or the seed
+    AlarmChangeCleared                        // alarm cleared, it stays in the table until deleted
+    AlarmChangeRemoved                        // alarm deleted from the device
+)
+
+func (k AlarmChangeKind) String() string {
+    switch k {
+    case AlarmChangeRaised:
+        return "raised"
+    case AlarmChangeCleared:
+        return "cleared"
+    case AlarmChangeRemoved:
+        return "removed"
+    }
+    return fmt.Sprintf("AlarmChangeKind(%d)", int(k))
+}
+
+type AlarmChange struct {
+    Kind  AlarmChangeKind
+    Alarm Alarm // the state after the change, or the last state if removed
+}
+
+//
+// AlarmTracker keeps the alarms of one or more devices, keyed by farmer and
+// alarm id, up to date from alarm-added, alarm-cleared and alarm-deleted
+// events. Seed loads the alarms a device already has. Every change is also
+// sent to the channels returned by Watch.
+//
+
+type AlarmTracker struct {
+    mu       sync.Mutex
+    alarms   map[string]map[string]Alarm // farmer -> alarm id -> alarm
+    watchers map[*alarmWatcher]struct{}
+
+    feed sync.Mutex // held from a change until it is sent, keeping changes in order
+}
+
+type alarmWatcher struct {
+    ch   chan AlarmChange
+    done chan struct{} // closed when the watcher stops
+}
+
+func NewAlarmTracker() *AlarmTracker {
+    return &AlarmTracker{alarms: make(map[string]map[string]Alarm), watchers: make(map[*alarmWatcher]struct{})}
+}
+
+//
+// Seed replaces the alarms of farmer with those the device reports, sending
+// a change for every alarm that was not known yet or changed state. If the
+// device refuses the query the alarms of farmer are left as they are and the
+// error is returned; the tracker still builds them up from events, so the
+// caller can log the error and carry on. Apply waits for the query, so an
+// event arriving meanwhile is applied on top of what the device reported
+// instead of being overwritten by it.
+//
+
+func (t *AlarmTracker) Seed(ctx context.Context, c *Client, farmer string) error {
+    t.feed.Lock()
+    defer t.feed.Unlock()
+
+    alarms, err := c.Alarms(ctx, farmer)
+    if err != nil {
+        return err
+    }
+
+    t.mu.Lock()
+    old := t.alarms[farmer]
+    table := make(map[string]Alarm, len(alarms))
+    var changes []AlarmChange
+    for _, a := range alarms {
+        table[a.Id] = a
+        prev, known := old[a.Id]
+        switch {
+        case !known && a.Active(), known && !prev.Active() && a.Active():
+            changes = append(changes, AlarmChange{AlarmChangeRaised, a})
+        case !a.Active() && (!known || prev.Active()):
+            changes = append(changes, AlarmChange{AlarmChangeCleared, a})
+        }
+    }
+    for id, a := range old {
+        if _, ok := table[id]; !ok {
+            changes = append(changes, AlarmChange{AlarmChangeRemoved, a})
+        }
+    }
+    t.alarms[farmer] = table
+    t.mu.Unlock()
+
+    t.notify(changes)
+    return nil
+}
+
+//
+// Apply updates the alarms of farmer from an event and reports whether it
+// was an alarm event.
+//
+
+func (t *AlarmTracker) Apply(farmer string, d DecodedEvent) bool {
+    var change AlarmChange
+
+    t.feed.Lock()
+    defer t.feed.Unlock()
+    t.mu.Lock()
+    table := t.alarms[farmer]
+    if table == nil {
+        table = make(map[string]Alarm)
+        t.alarms[farmer] = table
+    }
+    switch e := d.(type) {
+    case *AlarmAdded:
+        a := Alarm{Farmer: farmer, Id: e.Id, Severity: e.Severity, Description: e.Description, Raised: e.Time}
+        if a.Raised.IsZero() {
+            a.Raised = e.Created
+        }
+        table[a.Id] = a
+        change = AlarmChange{AlarmChangeRaised, a}
+    case *AlarmCleared:
+        a, ok := table[e.Id]
+        if !ok {
+            a = Alarm{Farmer: farmer, Id: e.Id, Raised: e.Created} // raised before we were watching
+        }
+        a.Cleared = e.ClearedTime
+        if a.Cleared.IsZero() {
+            a.Cleared = time.Now()
+        }
+        table[a.Id] = a
+        change = AlarmChange{AlarmChangeCleared, a}
+    case *AlarmDeleted:
+        a, ok := table[e.Id]
+        if !ok {
+            t.mu.Unlock()
+            return true
+        }
+        delete(table, e.Id)
+        change = AlarmChange{AlarmChangeRemoved, a}
+    default:
+        t.mu.Unlock()
+        return false
+    }
+    t.mu.Unlock()
+
+    t.notify([]AlarmChange{change})
+    return true
+}
+
+//
+// Register sets the handlers of the three alarm event types in r to update
+// the alarms of farmer.
+//
+
+func (t *AlarmTracker) Register(r *EventHandlers, farmer string) {
+    apply := func(d DecodedEvent) { t.Apply(farmer, d) }
+    r.Handle(string(AlarmAddedEvent), apply)
+    r.Handle(string(AlarmClearedEvent), apply)
+    r.Handle(string(AlarmDeletedEvent), apply)
+}
+
+// Alarm returns the alarm id of farmer, if the tracker knows it.
+func (t *AlarmTracker) Alarm(farmer, id string) (Alarm, bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    a, ok := t.alarms[farmer][id]
+    return a, ok
+}
+
+// Alarms returns the alarms of farmer, active and cleared, oldest first.
+func (t *AlarmTracker) Alarms(farmer string) []Alarm {
+    return t.list(farmer, false)
+}
+
+// Active returns the active alarms of farmer, oldest first.
+func (t *AlarmTracker) Active(farmer string) []Alarm {
+    return t.list(farmer, true)
+}
+
+// Farmers returns the devices the tracker has alarms for.
+func (t *AlarmTracker) Farmers() []string {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    farmers := make([]string, 0, len(t.alarms))
+    for f := range t.alarms {
+        farmers = append(farmers, f)
+    }
+    sort.Strings(farmers)
+    return farmers
+}
+
+func (t *AlarmTracker) list(farmer string, activeOnly bool) []Alarm {
+    t.mu.Lock()
+    var alarms []Alarm
+    for _, a := range t.alarms[farmer] {
+        if !activeOnly || a.Active() {
+            alarms = append(alarms, a)
+        }
+    }
+    t.mu.Unlock()
+
+    sort.Slice(alarms, func(i, j int) bool {
+        if !alarms[i].Raised.Equal(alarms[j].Raised) {
+            return alarms[i].Raised.Before(alarms[j].Raised)
+        }
+        return alarms[i].Id < alarms[j].Id
+    })
+    return alarms
+}
+
+//
+// Watch returns a channel receiving every change from now on, and a function
+// that stops the feed and closes the channel. Changes are sent while the
+// event is handled, so a reader that falls more than buffer changes behind
+// holds up the event source.
+//
+
+func (t *AlarmTracker) Watch(buffer int) (<-chan AlarmChange, func()) {
+    w := &alarmWatcher{ch: make(chan AlarmChange, buffer), done: make(chan struct{})}
+    t.mu.Lock()
+    t.watchers[w] = struct{}{}
+    t.mu.Unlock()
+
+    var once sync.Once
+    return w.ch, func() {
+        once.Do(func() {
+            t.mu.Lock()
+            delete(t.watchers, w)
+            t.mu.Unlock()
+            close(w.done)
+
+            t.feed.Lock()
+            close(w.ch)
+            t.feed.Unlock()
+        })
+    }
+}
+
+// notify sends changes to the watchers; t.feed must be held.
+func (t *AlarmTracker) notify(changes []AlarmChange) {
+    if len(changes) == 0 {
+        return
+    }
+    t.mu.Lock()
+    watchers := make([]*alarmWatcher, 0, len(t.watchers))
+    for w := range t.watchers {
+        watchers = append(watchers, w)
+    }
+    t.mu.Unlock()
+
+    for _, w := range watchers {
+        for _, c := range changes {
+            select {
+            case w.ch <- c:
+            case <-w.done:
+            }
+        }
+    }
+}
@@ -0,0 +1,143 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestAlarmTracker(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var req AlarmsRequest
+        xml.Unmarshal(body, &req)
+        if req.Category != "alarm" || req.Path.Farmer() != "ME-7000-2" {
+            t.Errorf("unexpected request %s", body)
+        }
+        fmt.Fprint(w, `<response command="get" category="alarm"><alarm-list>`+
+            `<alarm id="1435316297245" severity="major" description="Input loss" time="2015-06-26T10:58:17.245Z"/>`+
+            `<alarm id="1435265291353" severity="minor" time="2015-06-25T20:48:11.353Z" cleared-time="2015-06-26T16:38:02.513Z"/>`+
+            `</alarm-list></response>`)
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{})
+    tr := NewAlarmTracker()
+    changes, stop := tr.Watch(10)
+    defer stop()
+
+    if err := tr.Seed(context.Background(), c, "ME-7000-2"); err != nil {
+        t.Fatal(err)
+    }
+    if got := tr.Alarms("ME-7000-2"); len(got) != 2 || got[0].Id != "1435265291353" {
+        t.Fatalf("seeded %v", got)
+    }
+    if got := tr.Active("ME-7000-2"); len(got) != 1 || got[0].Severity != "major" {
+        t.Fatalf("active after seed %v", got)
+    }
+
+    r := &EventHandlers{}
+    tr.Register(r, "ME-7000-2")
+    for _, e := range []EventType{
+        {Type: string(AlarmAddedEvent), Id: "1435316300000", Attrs: []xml.Attr{{Name: xml.Name{Local: "severity"}, Value: "critical"}}},
+        {Type: string(AlarmClearedEvent), Id: "1435316297245", Attrs: []xml.Attr{{Name: xml.Name{Local: "cleared-time"}, Value: "2015-06-26T16:40:00.000Z"}}},
+        {Type: string(AlarmDeletedEvent), Id: "1435265291353"},
+    } {
+        if err := r.Dispatch(e); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    a, ok := tr.Alarm("ME-7000-2", "1435316297245")
+    if !ok || a.Active() || a.Cleared.Format(TimeLayout) != "2015-06-26T16:40:00.000Z" {
+        t.Errorf("cleared alarm is %+v", a)
+    }
+    if got := tr.Active("ME-7000-2"); len(got) != 1 || got[0].Id != "1435316300000" || got[0].Severity != "critical" {
+        t.Errorf("active %v", got)
+    }
+
+    var feed []string
+    for len(changes) > 0 {
+        ch := <-changes
+        feed = append(feed, ch.Kind.String()+" "+ch.Alarm.Id)
+    }
+    want := []string{"raised 1435316297245", "cleared 1435265291353", "raised 1435316300000", "cleared 1435316297245", "removed 1435265291353"}
+    if fmt.Sprint(feed) != fmt.Sprint(want) {
+        t.Errorf("changes %v\nwant %v", feed, want)
+    }
+}
+
+func TestAlarmTrackerSeedRefused(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, `<response command="get" category="alarm" status="error">`+
+            `<reason error-code="Unknown_Error"><![CDATA[Invalid path /farmer.]]></reason></response>`)
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{})
+    tr := NewAlarmTracker()
+    if err := tr.Seed(context.Background(), c, "ME-7000-2"); err == nil {
+        t.Fatal("Seed succeeded on a refused query")
+    }
+
+    e := EventType{Type: string(AlarmAddedEvent), Id: "1435316300000", Attrs: []xml.Attr{{Name: xml.Name{Local: "severity"}, Value: "critical"}}}
+    d, err := e.Decode()
+    if err != nil {
+        t.Fatal(err)
+    }
+    tr.Apply("ME-7000-2", d)
+    if got := tr.Active("ME-7000-2"); len(got) != 1 || got[0].Severity != "critical" {
+        t.Errorf("active after a failed seed %v", got)
+    }
+}
+
+func TestAlarmTrackerEventDuringSeed(t *testing.T) {
+    queried, release := make(chan struct{}), make(chan struct{})
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        close(queried)
+        <-release // the alarm below is raised after the device took its snapshot
+        fmt.Fprint(w, `<response command="get" category="alarm"><alarm-list>`+
+            `<alarm id="1435316297245" severity="major" time="2015-06-26T10:58:17.245Z"/></alarm-list></response>`)
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{})
+    tr := NewAlarmTracker()
+    changes, stop := tr.Watch(10)
+    defer stop()
+
+    seeded := make(chan error)
+    go func() { seeded <- tr.Seed(context.Background(), c, "ME-7000-2") }()
+    <-queried
+
+    applied := make(chan struct{})
+    go func() {
+        e := EventType{Type: string(AlarmAddedEvent), Id: "1435316300000", Attrs: []xml.Attr{{Name: xml.Name{Local: "severity"}, Value: "critical"}}}
+        d, _ := e.Decode()
+        tr.Apply("ME-7000-2", d)
+        close(applied)
+    }()
+    time.Sleep(20 * time.Millisecond) // give Apply the time to reach the tracker
+    close(release)
+    if err := <-seeded; err != nil {
+        t.Fatal(err)
+    }
+    <-applied
+
+    if got := tr.Active("ME-7000-2"); len(got) != 2 {
+        t.Errorf("active %v, want the seeded alarm and the one raised during the seed", got)
+    }
+    var feed []string
+    for len(changes) > 0 {
+        ch := <-changes
+        feed = append(feed, ch.Kind.String()+" "+ch.Alarm.Id)
+    }
+    if want := []string{"raised 1435316297245", "raised 1435316300000"}; fmt.Sprint(feed) != fmt.Sprint(want) {
+        t.Errorf("changes %v\nwant %v", feed, want)
+    }
+}
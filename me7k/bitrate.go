@@ -0,0 +1,133 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "fmt"
+    "strconv"
+    "time"
+)
+
+/*
+ * Body of a bit-rate-event, see the get event response in messages.go:
+ *
+ * <path>
+ *   <farmer id="ME-7000-1"/>
+ *   <board id="4"/>
+ *   <gige-line id="4/3"/>
+ *   <gige-output-mux id="0000"/>
+ * </path>
+ * <gige-output-mux id="0000" avg-bit-rate="0" inst-bit-rate="0" overhead="0">
+ *   <output-program id="1" avg-bit-rate="0" inst-bit-rate="0">
+ *     <stream id="32" avg-bit-rate="0" inst-bit-rate="0" std-dev="0"/>
+ *   </output-program>
+ *   <passed-pids id="65536" avg-bit-rate="0" inst-bit-rate="0"/>
+ * </gige-output-mux>
+ *
+ * Bit rates are in bits per second.
+ */
+
+const BitRateEventType = "bit-rate-event"
+
+type MuxBitRate struct {
+    XMLName     xml.Name         `xml:"gige-output-mux"`
+    Id          string           `xml:"id,attr"`
+    AvgBitRate  int64            `xml:"avg-bit-rate,attr"`
+    InstBitRate int64            `xml:"inst-bit-rate,attr"`
+    Overhead    int64            `xml:"overhead,attr"`
+    Programs    []ProgramBitRate `xml:"output-program"`
+    PassedPids  []PidBitRate     `xml:"passed-pids"`
+}
+
+type ProgramBitRate struct {
+    XMLName     xml.Name        `xml:"output-program"`
+    Id          string          `xml:"id,attr"`
+    AvgBitRate  int64           `xml:"avg-bit-rate,attr"`
+    InstBitRate int64           `xml:"inst-bit-rate,attr"`
+    Streams     []StreamBitRate `xml:"stream"`
+}
+
+type StreamBitRate struct {
+    XMLName     xml.Name `xml:"stream"`
+    Id          string   `xml:"id,attr"` // the PID
+    AvgBitRate  int64    `xml:"avg-bit-rate,attr"`
+    InstBitRate int64    `xml:"inst-bit-rate,attr"`
+    StdDev      float64  `xml:"std-dev,attr"`
+}
+
+// PidBitRate is the rate of the PIDs passed through the mux without remultiplexing.
+type PidBitRate struct {
+    XMLName     xml.Name `xml:"passed-pids"`
+    Id          string   `xml:"id,attr"`
+    AvgBitRate  int64    `xml:"avg-bit-rate,attr"`
+    InstBitRate int64    `xml:"inst-bit-rate,attr"`
+}
+
+//
+// BitRateEvent is a decoded bit-rate-event.
+//
+
+type BitRateEvent struct {
+    Id      string    // event id as sent by the device
+    Created time.Time // from the id, its creation time in milliseconds since the epoch; zero if the id is not a time
+    Time    time.Time // time the rates were measured
+    Path    Path      // the subscription target
+    Mux     MuxBitRate
+}
+
+//
+// BitRate decodes e as a bit-rate-event.
+//
+
+func (e *EventType) BitRate() (*BitRateEvent, error) {
+    if e.Type != BitRateEventType {
+        return nil, fmt.Errorf("BitRate - event %s is a %s", e.Id, e.Type)
+    }
+
+    var body struct {
+        Path Path       `xml:"path"`
+        Mux  MuxBitRate `xml:"gige-output-mux"`
+    }
+    // Inner holds sibling elements, so give them a common parent to decode from
+    if err := xml.Unmarshal(append(append([]byte("<event>"), e.Inner...), "</event>"...), &body); err != nil {
+        return nil, fmt.Errorf("BitRate - Unmarshal error on event %s: %v", e.Id, err)
+    }
+
+    b := &BitRateEvent{Id: e.Id, Path: body.Path, Mux: body.Mux}
+    b.Created, _ = EventIdTime(e.Id) // not every event id is a time, keep the rates anyway
+    if e.Time != "" {
+        var err error
+        if b.Time, err = ParseTime(e.Time); err != nil {
+            return nil, err
+        }
+    }
+    return b, nil
+}
+
+//
+// BitRateEvents decodes every bit-rate-event of the response, skipping other types.
+//
+
+func (r *EventResponse) BitRateEvents() ([]*BitRateEvent, error) {
+    var events []*BitRateEvent
+    for i := range r.EventList.Events {
+        e := &r.EventList.Events[i]
+        if e.Type != BitRateEventType {
+            continue
+        }
+        b, err := e.BitRate()
+        if err != nil {
+            return events, err
+        }
+        events = append(events, b)
+    }
+    return events, nil
+}
+
+// EventIdTime returns the creation time encoded in an event or alarm id.
+func EventIdTime(id string) (time.Time, error) {
+    ms, err := strconv.ParseInt(id, 10, 64)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("EventIdTime - bad event id %q", id)
+    }
+    return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
@@ -0,0 +1,83 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "strings"
+    "testing"
+    "time"
+)
+
+const sampleBitRateEventResponse = `<response id="beacham" origin="device" destination="transcoder-collector" command="get" ` +
+    `category="event" time="2017-09-19T22:15:45.286Z" protocol-version="2.1" platform-name="neo" ` +
+    `sw-version="me7k.2.1.2" sw-build="0" pending-events="0"><event-list><event type="bit-rate-event" ` +
+    `id="1505838270680" time="2017-09-19T22:15:44.879Z">
+<path>
+  <farmer id="ME-7000-1"/>
+  <board id="4"/>
+  <gige-line id="4/3"/>
+  <gige-output-mux id="0000"/>
+</path>
+<gige-output-mux id="0000" avg-bit-rate="3750000" inst-bit-rate="3761200" overhead="12000">
+  <output-program id="1" avg-bit-rate="3700000" inst-bit-rate="3710000">
+    <stream id="32" avg-bit-rate="3500000" inst-bit-rate="3510000" std-dev="1250.5"/>
+    <stream id="33" avg-bit-rate="128000" inst-bit-rate="128000" std-dev="0"/>
+    <stream id="34" avg-bit-rate="72000" inst-bit-rate="72000" std-dev="0"/>
+  </output-program>
+   <passed-pids id="65536" avg-bit-rate="38000" inst-bit-rate="39200"/>
+  </gige-output-mux>
+</event></event-list></response>`
+
+func TestDecodeBitRateEvent(t *testing.T) {
+    rsp := EventResponse{}
+    if err := xml.Unmarshal([]byte(sampleBitRateEventResponse), &rsp); err != nil {
+        t.Fatal(err)
+    }
+    if rsp.PendingEvents != 0 || len(rsp.EventList.Events) != 1 {
+        t.Fatalf("got %+v", rsp)
+    }
+
+    events, err := rsp.BitRateEvents()
+    if err != nil || len(events) != 1 {
+        t.Fatalf("BitRateEvents = %v, %v", events, err)
+    }
+    e := events[0]
+
+    if want := time.Date(2017, 9, 19, 22, 15, 44, 879e6, time.UTC); !e.Time.Equal(want) {
+        t.Errorf("Time = %v, want %v", e.Time, want)
+    }
+    if want := time.Unix(1505838270, 680e6); !e.Created.Equal(want) {
+        t.Errorf("Created = %v, want %v", e.Created, want)
+    }
+    if e.Path.String() != "ME-7000-1/4/4-3/0000" {
+        t.Errorf("Path = %+v", e.Path)
+    }
+
+    m := e.Mux
+    if m.Id != "0000" || m.AvgBitRate != 3750000 || m.InstBitRate != 3761200 || m.Overhead != 12000 {
+        t.Errorf("Mux = %+v", m)
+    }
+    if len(m.Programs) != 1 || m.Programs[0].Id != "1" || m.Programs[0].InstBitRate != 3710000 {
+        t.Fatalf("Programs = %+v", m.Programs)
+    }
+    if s := m.Programs[0].Streams; len(s) != 3 || s[0].Id != "32" || s[0].StdDev != 1250.5 || s[2].AvgBitRate != 72000 {
+        t.Errorf("Streams = %+v", s)
+    }
+    if len(m.PassedPids) != 1 || m.PassedPids[0].Id != "65536" || m.PassedPids[0].InstBitRate != 39200 {
+        t.Errorf("PassedPids = %+v", m.PassedPids)
+    }
+}
+
+func TestDecodeBitRateEventId(t *testing.T) {
+    rsp := EventResponse{}
+    data := strings.Replace(sampleBitRateEventResponse, `id="1505838270680"`, `id="E17"`, 1)
+    if err := xml.Unmarshal([]byte(data), &rsp); err != nil {
+        t.Fatal(err)
+    }
+    events, err := rsp.BitRateEvents()
+    if err != nil || len(events) != 1 {
+        t.Fatalf("BitRateEvents = %v, %v", events, err)
+    }
+    if e := events[0]; !e.Created.IsZero() || e.Mux.Id != "0000" || e.Mux.AvgBitRate != 3750000 {
+        t.Errorf("event = %+v", e)
+    }
+}
@@ -0,0 +1,422 @@
+package me7k
+
+import (
+    "bytes"
+    "context"
+    "crypto/tls"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "net"
+    "net/http"
+    "net/http/httputil" // for DumpRequestOut
+    "net/url"
+    "sync"
+    "time"
+)
+
+const (
+    DefaultMaxIdleConnections int           = 20              // per device
+    DefaultRequestTimeout     time.Duration = 5 * time.Second // per request
+)
+
+const (
+    DefaultOrigin          string = "transcoder-collector"
+    DefaultVersion         string = "2.1" // what every known box speaks; set Options.Version to prefer 2.2
+    DefaultPlatform        string = "neo"
+    DefaultRequestIdPrefix string = "C" // the device GUI uses "G"
+)
+
+//
+// SessionType selects how the device delivers events for a login session:
+// pull sessions fetch them with "get event", push sessions use "add channel".
+//
+
+type SessionType string
+
+const (
+    SessionPull SessionType = "pull"
+    SessionPush SessionType = "push"
+)
+
+//
+// Options configures a Client. Zero values select the defaults above.
+//
+
+type Options struct {
+    User        string           // login name, e.g. "Admin"
+    Password    string           // login password, may be empty
+    Credentials CredentialSource // if set, asked for the user and password at every Login, see credentials.go
+    SessionType SessionType      // defaults to SessionPull
+
+    Origin          string // origin attribute of every request
+    Version         string // preferred protocol-version, see protocol.go
+    Platform        string // platform-name attribute of every request
+    RequestIdPrefix string // request ids are this prefix plus a sequence number
+
+    MaxIdleConnections int                      // idle connections kept per device
+    RequestTimeout     time.Duration            // timeout of a single HTTP exchange
+    Timeouts           map[string]time.Duration // per "command category", e.g. "get event", instead of RequestTimeout
+    Retry              *RetryPolicy             // nil selects DefaultRetryPolicy, see retry.go
+
+    HTTPClient *http.Client // if set, used instead of building a transport, and TLS is ignored
+    TLS        TLSOptions   // certificate verification and client certificate, see tls.go
+    Logger     *log.Logger  // if set, requests and responses are dumped here, redacted, see redact.go
+
+    DisableKeepAlive bool                        // do not keep idle sessions alive, see keepalive.go
+    OnSessionLost    func(sid string, err error) // called from the keepalive when the session is gone, err redacted
+
+    Reclaim *ReclaimPolicy // if set, Login removes our stale sessions when the device is full, see reclaim.go
+
+    DisableRelogin bool                        // do not replace lost sessions, see session.go
+    OnRelogin      func(oldSid, newSid string) // called after a lost session was replaced
+}
+
+//
+// Client talks to a single ME-7000 neo endpoint. It owns the HTTP transport,
+// the login session and the protocol settings, so any number of Clients may
+// run in one process against different devices.
+//
+
+type Client struct {
+    endpoint string
+    opts     Options
+    http     *http.Client
+    stream   *http.Client // same transport as http, without the timeout
+    log      *log.Logger
+    redact   *redactor
+
+    mu           sync.Mutex
+    session      Session    // zero until Login succeeds
+    user         string     // who the last Login was for
+    lastActivity time.Time  // when the device last accepted a request
+    keepAlive    *keepAlive // nil unless a session is being kept alive
+    dialect      Dialect    // negotiated at login
+
+    subs      map[string]subscription // active subscriptions by target, replayed on re-login
+    gen       int                     // number of re-logins
+    reloginMu sync.Mutex              // serializes re-logins
+}
+
+//
+// NewClient creates a Client for endpoint, e.g. "https://10.10.55.163/neoreq/".
+// No request is sent until Login is called.
+//
+
+func NewClient(endpoint string, opts Options) (*Client, error) {
+    u, err := url.Parse(endpoint)
+    if err != nil {
+        return nil, fmt.Errorf("NewClient - bad endpoint %q: %v", endpoint, err)
+    }
+    if u.Scheme != "http" && u.Scheme != "https" {
+        return nil, fmt.Errorf("NewClient - endpoint %q is not an http(s) URL", endpoint)
+    }
+
+    if opts.SessionType == "" {
+        opts.SessionType = SessionPull
+    }
+    if opts.Origin == "" {
+        opts.Origin = DefaultOrigin
+    }
+    if opts.Version == "" {
+        opts.Version = DefaultVersion
+    }
+    if v, err := ParseProtocolVersion(opts.Version); err != nil || v.Less(MinProtocolVersion) || MaxProtocolVersion.Less(v) {
+        return nil, fmt.Errorf("NewClient - %w %q, this package speaks %s to %s",
+            ErrUnsupportedVersion, opts.Version, MinProtocolVersion, MaxProtocolVersion)
+    }
+    if opts.Platform == "" {
+        opts.Platform = DefaultPlatform
+    }
+    if opts.RequestIdPrefix == "" {
+        opts.RequestIdPrefix = DefaultRequestIdPrefix
+    }
+    if opts.MaxIdleConnections == 0 {
+        opts.MaxIdleConnections = DefaultMaxIdleConnections
+    }
+    if opts.RequestTimeout == 0 {
+        opts.RequestTimeout = DefaultRequestTimeout
+    }
+
+    c := &Client{endpoint: endpoint, opts: opts, http: opts.HTTPClient, redact: &redactor{}}
+    if l := opts.Logger; l != nil {
+        c.log = log.New(redactWriter{c.redact, l.Writer()}, l.Prefix(), l.Flags())
+    } else {
+        c.log = log.New(ioutil.Discard, "", 0)
+    }
+    c.redact.addSecret(opts.Password, redactedPassword)
+
+    if c.http == nil {
+        host := u.Host
+        if u.Port() == "" {
+            host = net.JoinHostPort(u.Hostname(), map[string]string{"http": "80", "https": "443"}[u.Scheme])
+        }
+        tlsConfig, err := opts.TLS.tlsConfig(host, c.log.Printf)
+        if err != nil {
+            return nil, fmt.Errorf("NewClient - TLS: %w", err)
+        }
+        c.http = createHTTPClient(opts, tlsConfig)
+    }
+    stream := *c.http
+    stream.Timeout = 0 // an add channel response stays open for the whole session
+    c.stream = &stream
+    return c, nil
+}
+
+//
+// createHTTPClient for connection re-use
+//
+
+func createHTTPClient(opts Options, tlsConfig *tls.Config) *http.Client {
+    client := &http.Client{
+        Transport: &http.Transport{
+            MaxIdleConnsPerHost: opts.MaxIdleConnections,
+            TLSClientConfig:     tlsConfig,
+        },
+        // no Timeout, every request gets its own, see retry.go
+    }
+
+    return client
+}
+
+// Endpoint returns the URL the Client posts requests to.
+func (c *Client) Endpoint() string {
+    return c.endpoint
+}
+
+// Session returns the current login session, or the zero Session if not logged in.
+func (c *Client) Session() Session {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.session
+}
+
+func (c *Client) sessionId() string {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.session.SessionId
+}
+
+//
+// Login opens a session on the device. The session id returned by the device
+// is kept by the Client and sent with every subsequent request. Like every
+// request of the Client, it is aborted, retries included, when ctx is done.
+//
+
+func (c *Client) Login(ctx context.Context) (*Session, error) {
+
+    cred, err := c.credentials(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("Login - %w", err)
+    }
+
+    v := &LoginRequest{Envelope: c.envelope("add", "login")}
+    v.SessionId = "" // a new session is being requested
+    v.Version = c.opts.Version
+    v.User = User{Name: cred.User, Password: cred.Password, Type: string(c.opts.SessionType)}
+
+    rsp := LoginResponse{}
+    err = c.call(ctx, "Login", v, &rsp)
+    if errors.Is(err, ErrSessionLimit) && c.opts.Reclaim != nil {
+        n, rerr := c.reclaimSessions(ctx, c.opts.Reclaim)
+        if n == 0 && rerr != nil {
+            return nil, fmt.Errorf("%w (reclaiming stale sessions: %v)", err, rerr)
+        }
+        if n == 0 {
+            return nil, fmt.Errorf("%w (no stale session to reclaim)", err)
+        }
+        c.log.Printf("Login - reclaimed %d sessions, trying again", n)
+        v.Envelope = c.envelope("add", "login")
+        v.SessionId = ""
+        v.Version = c.opts.Version
+        err = c.call(ctx, "Login", v, &rsp)
+    }
+    if err != nil {
+        return nil, err
+    }
+    if rsp.Session.SessionId == "" {
+        return nil, fmt.Errorf("Login - no session in Login Response")
+    }
+    c.redact.addSessionId(rsp.Session.SessionId)
+
+    preferred, _ := ParseProtocolVersion(c.opts.Version) // checked by NewClient
+    d, err := negotiate(preferred, &rsp.ResponseEnvelope)
+    if err != nil {
+        r := &RemoveLoginRequest{Envelope: c.envelope("remove", "login")}
+        r.SessionId = rsp.Session.SessionId
+        c.callOnce(ctx, "Login", r, nil) // don't leave the session behind
+        return nil, err
+    }
+    if d.Version != preferred {
+        c.log.Printf("Login - device %s speaks protocol %s, using it instead of %s", d.SwVersion, d.Device, preferred)
+    }
+
+    c.mu.Lock()
+    c.session = rsp.Session
+    c.dialect = d
+    c.mu.Unlock()
+
+    if !c.opts.DisableKeepAlive {
+        c.startKeepAlive(rsp.Session)
+    }
+
+    s := rsp.Session
+    return &s, nil
+}
+
+//
+// Subscribe adds a bit rate event subscription for the line, mux or program
+// addressed by path.
+//
+
+func (c *Client) Subscribe(ctx context.Context, path Path, event EventBitRate) error {
+    if err := c.call(ctx, "Subscribe", c.bitRateRequest("add", path, event), nil); err != nil {
+        return err
+    }
+    c.addSubscription("bitrate:"+path.String(), subscription{
+        name:   "bit rate subscription " + path.String(),
+        add:    func() request { return c.bitRateRequest("add", path, event) },
+        remove: func() request { return c.bitRateRequest("remove", path, EventBitRate{Type: BitRateEventType}) },
+    })
+    return nil
+}
+
+//
+// Unsubscribe removes the bit rate event subscription for path.
+//
+
+func (c *Client) Unsubscribe(ctx context.Context, path Path) error {
+    if err := c.call(ctx, "Unsubscribe", c.bitRateRequest("remove", path, EventBitRate{Type: BitRateEventType}), nil); err != nil {
+        return err // still on the device, so still replayed and removed at shutdown
+    }
+    c.removeSubscription("bitrate:" + path.String())
+    return nil
+}
+
+func (c *Client) bitRateRequest(command string, path Path, event EventBitRate) *BitRateRequest {
+    b := &BitRateRequest{Envelope: c.envelope(command, "subscription")}
+    b.Path = path
+    b.Event.EventBitRate = event
+    return b
+}
+
+//
+// GetEvents fetches the events queued for a pull session. PendingEvents of the
+// response tells how many more are waiting on the device.
+//
+
+func (c *Client) GetEvents(ctx context.Context) (*EventResponse, error) {
+    a := &EventRequest{Envelope: c.envelope("get", "event")}
+
+    rsp := &EventResponse{}
+    if err := c.call(ctx, "GetEvents", a, rsp); err != nil {
+        return nil, err
+    }
+    return rsp, nil
+}
+
+//
+// Logout removes the login session from the device. The device only allows a
+// handful of sessions, so every successful Login should be paired with Logout.
+//
+
+func (c *Client) Logout(ctx context.Context) error {
+    c.stopKeepAlive()
+
+    r := &RemoveLoginRequest{Envelope: c.envelope("remove", "login")}
+
+    if err := c.callOnce(ctx, "Logout", r, nil); err != nil {
+        return err
+    }
+
+    c.mu.Lock()
+    c.session = Session{}
+    c.dialect = Dialect{}
+    c.subs = nil // the device drops them with the session
+    c.mu.Unlock()
+    return nil
+}
+
+func decodeResponse(name string, body []byte, rsp interface{}) error {
+    r := Response{}
+    if err := xml.Unmarshal(body, &r); err != nil {
+        return fmt.Errorf("%s - Unmarshal error on Response: %v", name, err)
+    }
+    if err := r.Err(); err != nil {
+        return err
+    }
+    if rsp == nil {
+        return nil
+    }
+    if err := xml.Unmarshal(body, rsp); err != nil {
+        return fmt.Errorf("%s - Unmarshal error on Response: %v", name, err)
+    }
+    return nil
+}
+
+//
+// sendOnce marshals v, posts it to the endpoint and returns the response body.
+// name prefixes log lines and errors. See send for the retries.
+//
+
+func (c *Client) sendOnce(ctx context.Context, name string, v interface{}) ([]byte, error) {
+
+    response, err := c.post(ctx, name, c.http, v)
+    if err != nil {
+        return nil, err
+    }
+    // Close the connection to reuse it
+    defer response.Body.Close()
+
+    body, err := ioutil.ReadAll(response.Body)
+    if err != nil {
+        return nil, fmt.Errorf("%s - Couldn't read response body. %w", name, err)
+    }
+
+    c.log.Printf("%s - Response Body:\n%s", name, body)
+
+    if response.StatusCode != http.StatusOK {
+        // the device may still explain itself with an error response
+        r := Response{}
+        if xml.Unmarshal(body, &r) == nil {
+            if err := r.Err(); err != nil {
+                return nil, err
+            }
+        }
+        return nil, &StatusError{Name: name, Code: response.StatusCode}
+    }
+    return body, nil
+}
+
+//
+// post marshals v and posts it to the endpoint with hc. The caller must close
+// the response body.
+//
+
+func (c *Client) post(ctx context.Context, name string, hc *http.Client, v interface{}) (*http.Response, error) {
+
+    output, err := Marshal(v)
+    if err != nil {
+        return nil, fmt.Errorf("%s - Marshal error: %v", name, err)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(output))
+    if err != nil {
+        return nil, fmt.Errorf("%s - Error Occured on httpNewRequest. %v", name, err)
+    }
+    req.Header.Add("Content-Type", "text/xml; charset=utf-8")
+
+    // Dump the prepared request going to the server
+    if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+        c.log.Printf("%s - Request:\n%s", name, dump)
+    }
+
+    response, err := hc.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("%s - Error sending request to API endpoint. %w", name, err)
+    }
+
+    return response, nil
+}
@@ -0,0 +1,528 @@
+package me7k
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/url"
+    "strings"
+    "time"
+)
+
+/*
+ * Format of the collector configuration file (TOML, see toml.go):
+ *
+ * # defaults for every device
+ * user = "Admin"
+ * password-env = "ME7K_PASSWORD"  # or password = "...", credentials-file = "/etc/me7k/admin" (mode 600),
+ *                                # credentials-command = ["pass", "show", "me7k/admin"], see credentials.go
+ * session-type = "pull"          # or "push"
+ * duration = "1m"                # stop after this long, "" or absent runs until interrupted
+ * known-hosts = "known_hosts"    # TLS, see tls.go: ca-file, fingerprints = ["AB:CD:..."], known-hosts,
+ *                                # client-cert, client-key, insecure-skip-verify = true
+ *
+ * [[device]]
+ * name = "horsham"
+ * endpoint = "https://10.10.55.163/neoreq/"
+ * farmer = "ME-7000-2"
+ * session-type = "push"          # overrides the default
+ * device-events = ["alarm-added", "alarm-cleared", "alarm-deleted", "heartbeat"]
+ *
+ * [[device.bitrate]]             # belongs to the [[device]] above it
+ * board = "4"
+ * gige-line = "4/3"
+ * mux = "0000"                   # program = "1" for a program; or path = "ME-7000-2/4/4-3/0000"
+ * get-streams = true
+ * get-std-dev = true
+ * get-inst-br = true
+ * get-avg-br = false
+ *
+ * Event names may leave off the "-event" suffix; "all" selects every device-wide event.
+ */
+
+//
+// Config is a parsed and validated configuration file.
+//
+
+type Config struct {
+    File     string
+    Duration time.Duration // 0 to run until interrupted
+    Devices  []DeviceConfig
+}
+
+type DeviceConfig struct {
+    Name         string
+    Endpoint     string
+    User         string
+    Password     string
+    UserEnv      string // environment variables to read the credentials from
+    PasswordEnv  string
+    CredFile     string   // file with the user and password, see FileCredentials
+    CredCommand  []string // helper and its arguments, see CommandCredentials
+    SessionType  SessionType
+    Reclaim      bool
+    TLS          TLSOptions
+    Farmer       string
+    DeviceEvents []DeviceEventType
+    BitRates     []BitRateConfig
+    Line         int // of the [[device]] header
+}
+
+type BitRateConfig struct {
+    Path  Path
+    Event EventBitRate
+    Line  int // of the [[device.bitrate]] header
+}
+
+//
+// LoadConfig reads and validates the configuration file name. Errors carry
+// the file name and line; all validation errors are reported at once.
+//
+
+func LoadConfig(name string) (*Config, error) {
+    data, err := ioutil.ReadFile(name)
+    if err != nil {
+        return nil, fmt.Errorf("LoadConfig - %v", err)
+    }
+    return ParseConfig(name, string(data))
+}
+
+// ParseConfig parses and validates src, the contents of the file name.
+func ParseConfig(name, src string) (*Config, error) {
+    tables, err := parseTOML(name, src)
+    if err != nil {
+        return nil, err
+    }
+
+    b := &configBinder{file: name}
+    cfg := &Config{File: name}
+    var defaults DeviceConfig
+    defaultsSet := map[string]bool{}
+
+    for _, t := range tables {
+        switch t.name {
+        case "":
+            b.deviceKeys(t, &defaults, defaultsSet, true)
+            if v, ok := t.keys["duration"]; ok {
+                if s, ok := b.str(v, "duration"); ok && s != "" {
+                    d, err := time.ParseDuration(s)
+                    if err != nil || d < 0 {
+                        b.errorf(v.line, "duration %q is not a duration like \"90s\" or \"1h\"", s)
+                    }
+                    cfg.Duration = d
+                }
+            }
+        case "device":
+            if !t.array {
+                b.errorf(t.line, "use [[device]], one per device")
+                continue
+            }
+            d := DeviceConfig{Line: t.line}
+            set := map[string]bool{}
+            b.deviceKeys(t, &d, set, false)
+            if !set["user"] {
+                d.User = defaults.User
+            }
+            if !set["password"] && !set["user-env"] && !set["password-env"] && !set["credentials-file"] && !set["credentials-command"] {
+                d.Password = defaults.Password
+                d.UserEnv, d.PasswordEnv = defaults.UserEnv, defaults.PasswordEnv
+                d.CredFile, d.CredCommand = defaults.CredFile, defaults.CredCommand
+            }
+            if !set["session-type"] {
+                d.SessionType = defaults.SessionType
+            }
+            if !set["reclaim"] {
+                d.Reclaim = defaults.Reclaim
+            }
+            inheritTLS(&d.TLS, defaults.TLS, set)
+            cfg.Devices = append(cfg.Devices, d)
+        case "device.bitrate":
+            if !t.array {
+                b.errorf(t.line, "use [[device.bitrate]], one per subscription")
+                continue
+            }
+            if len(cfg.Devices) == 0 {
+                b.errorf(t.line, "[[device.bitrate]] must follow the [[device]] it belongs to")
+                continue
+            }
+            d := &cfg.Devices[len(cfg.Devices)-1]
+            d.BitRates = append(d.BitRates, b.bitRate(t, d.Farmer))
+        default:
+            b.errorf(t.line, "unknown table [%s], expected [[device]] or [[device.bitrate]]", t.name)
+        }
+    }
+
+    b.validate(cfg)
+    if len(b.errs) > 0 {
+        return nil, errors.Join(b.errs...)
+    }
+    return cfg, nil
+}
+
+//
+// Options returns base with the device's credentials and session type.
+//
+
+func (d DeviceConfig) Options(base Options) Options {
+    base.User = d.User
+    base.Password = d.Password
+    switch {
+    case d.UserEnv != "" || d.PasswordEnv != "":
+        base.Credentials = EnvCredentials(d.UserEnv, d.PasswordEnv)
+    case d.CredFile != "":
+        base.Credentials = FileCredentials(d.CredFile)
+    case len(d.CredCommand) > 0:
+        base.Credentials = CommandCredentials(d.CredCommand[0], d.CredCommand[1:]...)
+    }
+    base.SessionType = d.SessionType
+    base.TLS = d.TLS
+    if d.Reclaim && base.Reclaim == nil {
+        base.Reclaim = &ReclaimPolicy{Origin: true, MinIdle: time.Minute}
+    }
+    return base
+}
+
+//
+// Subscribe makes the subscriptions the device lists. It is meant as
+// Device.Setup of a fleet, see Device.
+//
+
+func (d DeviceConfig) Subscribe(ctx context.Context, c *Client) error {
+    if len(d.DeviceEvents) > 0 {
+        if err := c.SubscribeDevice(ctx, d.Farmer, d.DeviceEvents...); err != nil {
+            return err
+        }
+    }
+    for _, br := range d.BitRates {
+        if err := c.Subscribe(ctx, br.Path, br.Event); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Device returns the fleet member for d, see NewFleet.
+func (d DeviceConfig) Device(base Options) Device {
+    return Device{Name: d.Name, Endpoint: d.Endpoint, Options: d.Options(base), Setup: d.Subscribe}
+}
+
+type configBinder struct {
+    file string
+    errs []error
+}
+
+func (b *configBinder) errorf(line int, format string, args ...interface{}) {
+    b.errs = append(b.errs, &ConfigError{File: b.file, Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (b *configBinder) str(v tomlValue, key string) (string, bool) {
+    s, ok := v.v.(string)
+    if !ok {
+        b.errorf(v.line, "%s must be a quoted string", key)
+    }
+    return s, ok
+}
+
+func (b *configBinder) strings(v tomlValue, key string) []string {
+    list, ok := v.v.([]tomlValue)
+    if !ok {
+        b.errorf(v.line, `%s must be a list like ["helper", "arg"]`, key)
+        return nil
+    }
+    var ss []string
+    for _, e := range list {
+        if s, ok := b.str(e, key+" entry"); ok {
+            ss = append(ss, s)
+        }
+    }
+    return ss
+}
+
+func (b *configBinder) boolean(v tomlValue, key string) (bool, bool) {
+    x, ok := v.v.(bool)
+    if !ok {
+        b.errorf(v.line, "%s must be true or false", key)
+    }
+    return x, ok
+}
+
+//
+// deviceKeys sets the keys of a [[device]] table, or of the top level, which
+// may only hold defaults, into d and records which were set.
+//
+
+func (b *configBinder) deviceKeys(t *tomlTable, d *DeviceConfig, set map[string]bool, top bool) {
+    for _, k := range t.order {
+        v := t.keys[k]
+        set[k] = true
+        switch k {
+        case "user":
+            d.User, _ = b.str(v, k)
+        case "password":
+            d.Password, _ = b.str(v, k)
+        case "user-env":
+            d.UserEnv, _ = b.str(v, k)
+        case "password-env":
+            d.PasswordEnv, _ = b.str(v, k)
+        case "credentials-file":
+            d.CredFile, _ = b.str(v, k)
+        case "credentials-command":
+            d.CredCommand = b.strings(v, k)
+        case "session-type":
+            if s, ok := b.str(v, k); ok {
+                switch SessionType(s) {
+                case SessionPull, SessionPush:
+                    d.SessionType = SessionType(s)
+                default:
+                    b.errorf(v.line, "session-type %q must be \"pull\" or \"push\"", s)
+                }
+            }
+        case "reclaim":
+            d.Reclaim, _ = b.boolean(v, k)
+        case "ca-file":
+            d.TLS.CAFile, _ = b.str(v, k)
+        case "fingerprints":
+            d.TLS.Fingerprints = b.strings(v, k)
+            for i, f := range d.TLS.Fingerprints {
+                if _, err := normalizeFingerprint(f); err != nil {
+                    b.errorf(v.line, "fingerprint %d: %v", i+1, err)
+                }
+            }
+        case "known-hosts":
+            d.TLS.KnownHosts, _ = b.str(v, k)
+        case "client-cert":
+            d.TLS.ClientCert, _ = b.str(v, k)
+        case "client-key":
+            d.TLS.ClientKey, _ = b.str(v, k)
+        case "insecure-skip-verify":
+            d.TLS.InsecureSkipVerify, _ = b.boolean(v, k)
+        case "duration":
+            if !top {
+                b.errorf(v.line, "duration applies to the whole run, set it before the first [[device]]")
+            }
+        case "name", "endpoint", "farmer", "device-events":
+            if top {
+                b.errorf(v.line, "%s must be set per [[device]]", k)
+                continue
+            }
+            switch k {
+            case "name":
+                d.Name, _ = b.str(v, k)
+            case "endpoint":
+                d.Endpoint, _ = b.str(v, k)
+            case "farmer":
+                d.Farmer, _ = b.str(v, k)
+            case "device-events":
+                d.DeviceEvents = b.deviceEvents(v)
+            }
+        default:
+            where := "[[device]]"
+            if top {
+                where = "the top level"
+            }
+            b.errorf(v.line, "unknown key %q in %s", k, where)
+        }
+    }
+}
+
+// inheritTLS fills the TLS settings a [[device]] did not set from the defaults, but known-hosts for a device with fingerprints.
+func inheritTLS(t *TLSOptions, defaults TLSOptions, set map[string]bool) {
+    if !set["ca-file"] {
+        t.CAFile = defaults.CAFile
+    }
+    if !set["fingerprints"] {
+        t.Fingerprints = defaults.Fingerprints
+    }
+    if !set["known-hosts"] && len(t.Fingerprints) == 0 {
+        t.KnownHosts = defaults.KnownHosts // a pinned device is never trusted on first use
+    }
+    if !set["client-cert"] && !set["client-key"] {
+        t.ClientCert, t.ClientKey = defaults.ClientCert, defaults.ClientKey
+    }
+    if !set["insecure-skip-verify"] {
+        t.InsecureSkipVerify = defaults.InsecureSkipVerify
+    }
+}
+
+func (b *configBinder) deviceEvents(v tomlValue) []DeviceEventType {
+    list, ok := v.v.([]tomlValue)
+    if !ok {
+        b.errorf(v.line, `device-events must be a list like ["alarm-added", "heartbeat"]`)
+        return nil
+    }
+
+    var types []DeviceEventType
+    for _, e := range list {
+        s, ok := b.str(e, "device-events entry")
+        if !ok {
+            continue
+        }
+        if s == "all" {
+            types = append(types, AllDeviceEvents...)
+            continue
+        }
+        t := DeviceEventType(s)
+        if !strings.HasSuffix(s, "-event") {
+            t = DeviceEventType(s + "-event")
+        }
+        if !t.Valid() {
+            names := make([]string, len(AllDeviceEvents))
+            for i, a := range AllDeviceEvents {
+                names[i] = strings.TrimSuffix(string(a), "-event")
+            }
+            b.errorf(e.line, "unknown device event %q, expected one of %s or all", s, strings.Join(names, ", "))
+            continue
+        }
+        types = append(types, t)
+    }
+    return types
+}
+
+var bitRateFlags = map[string]func(e *EventBitRate) *string{
+    "get-streams":    func(e *EventBitRate) *string { return &e.GetStreams },
+    "get-std-dev":    func(e *EventBitRate) *string { return &e.GetStdDev },
+    "get-inst-br":    func(e *EventBitRate) *string { return &e.GetInstBr },
+    "get-avg-br":     func(e *EventBitRate) *string { return &e.GetAvgBr },
+    "get-video-info": func(e *EventBitRate) *string { return &e.GetVideoInfo },
+    "get-audio-info": func(e *EventBitRate) *string { return &e.GetAudioInfo },
+}
+
+var bitRateLevels = map[string]Level{
+    "board": LevelBoard, "gige-line": LevelGigeLine, "mux": LevelGigeOutputMux, "program": LevelOutputProgram,
+}
+
+func (b *configBinder) bitRate(t *tomlTable, farmer string) BitRateConfig {
+    br := BitRateConfig{Event: EventBitRate{Type: BitRateEventType}, Line: t.line}
+
+    var ids [numLevels]string
+    var pathValue *tomlValue
+    for _, k := range t.order {
+        v := t.keys[k]
+        if flag, ok := bitRateFlags[k]; ok {
+            if x, ok := b.boolean(v, k); ok {
+                *flag(&br.Event) = fmt.Sprint(x)
+            }
+            continue
+        }
+        if level, ok := bitRateLevels[k]; ok {
+            ids[level], _ = b.str(v, k)
+            continue
+        }
+        if k == "path" {
+            pathValue = &v
+            continue
+        }
+        b.errorf(v.line, "unknown key %q in [[device.bitrate]]", k)
+    }
+
+    hasIds := false
+    for _, id := range ids {
+        hasIds = hasIds || id != ""
+    }
+    switch {
+    case pathValue != nil && hasIds:
+        b.errorf(pathValue.line, "give either path or board, gige-line, mux and program, not both")
+    case pathValue != nil:
+        if s, ok := b.str(*pathValue, "path"); ok {
+            p, err := ParsePath(s)
+            if err != nil {
+                b.errorf(pathValue.line, "bad path %q: %v", s, err)
+            }
+            br.Path = p
+        }
+    default:
+        if farmer == "" {
+            b.errorf(t.line, "set farmer in the [[device]], or give the whole path")
+            return br
+        }
+        p := NewPath(farmer)
+        for l := LevelBoard; l < numLevels; l++ {
+            if ids[l] == "" {
+                break
+            }
+            p = p.At(l, ids[l])
+        }
+        for l := LevelBoard; l < numLevels; l++ {
+            if ids[l] != "" && l >= Level(p.Depth()) {
+                b.errorf(t.line, "%s is set but %s is missing", levelKey(l), levelKey(l-1))
+                break
+            }
+        }
+        br.Path = p
+    }
+    return br
+}
+
+func levelKey(l Level) string {
+    for k, v := range bitRateLevels {
+        if v == l {
+            return k
+        }
+    }
+    return l.String()
+}
+
+func (b *configBinder) validate(cfg *Config) {
+    if len(cfg.Devices) == 0 {
+        b.errs = append(b.errs, &ConfigError{File: b.file, Msg: "no [[device]] to collect from"})
+    }
+
+    names := map[string]int{}
+    for _, d := range cfg.Devices {
+        switch first, dup := names[d.Name]; {
+        case d.Name == "":
+            b.errorf(d.Line, "device has no name")
+        case dup:
+            b.errorf(d.Line, "device name %q already used at line %d", d.Name, first)
+        default:
+            names[d.Name] = d.Line
+        }
+
+        if d.Endpoint == "" {
+            b.errorf(d.Line, "device %s has no endpoint", d.Name)
+        } else if u, err := url.Parse(d.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            b.errorf(d.Line, "endpoint %q of device %s is not an http(s) URL", d.Endpoint, d.Name)
+        }
+        sources := 0
+        for _, set := range []bool{d.Password != "", d.UserEnv != "" || d.PasswordEnv != "", d.CredFile != "", len(d.CredCommand) > 0} {
+            if set {
+                sources++
+            }
+        }
+        if sources > 1 {
+            b.errorf(d.Line, "device %s has more than one of password, user-env/password-env, credentials-file and credentials-command", d.Name)
+        }
+        pinned := len(d.TLS.Fingerprints) > 0 || d.TLS.KnownHosts != ""
+        if d.TLS.InsecureSkipVerify && (pinned || d.TLS.CAFile != "") {
+            b.errorf(d.Line, "device %s: insecure-skip-verify cannot be combined with ca-file, fingerprints or known-hosts", d.Name)
+        }
+        if len(d.TLS.Fingerprints) > 0 && d.TLS.KnownHosts != "" {
+            b.errorf(d.Line, "device %s: fingerprints and known-hosts cannot be combined, a pinned device is never trusted on first use", d.Name)
+        }
+        if (d.TLS.ClientCert == "") != (d.TLS.ClientKey == "") {
+            b.errorf(d.Line, "device %s: client-cert and client-key go together", d.Name)
+        }
+        if d.User == "" && d.UserEnv == "" && d.CredFile == "" && len(d.CredCommand) == 0 {
+            b.errorf(d.Line, "device %s has no user", d.Name)
+        }
+        if len(d.DeviceEvents) > 0 && d.Farmer == "" {
+            b.errorf(d.Line, "device %s lists device-events but no farmer", d.Name)
+        }
+
+        for _, br := range d.BitRates {
+            if br.Path.Depth() == 0 {
+                continue // already reported
+            }
+            if br.Path.Level() < LevelGigeLine {
+                b.errorf(br.Line, "bit rates are reported per gige-line, mux or program, %s is a %s", br.Path, br.Path.Level())
+            }
+            if d.Farmer != "" && br.Path.Farmer() != d.Farmer {
+                b.errorf(br.Line, "path %s is not on farmer %s of device %s", br.Path, d.Farmer, d.Name)
+            }
+            if (br.Event.GetVideoInfo != "" || br.Event.GetAudioInfo != "") && br.Path.Level() != LevelOutputProgram {
+                b.errorf(br.Line, "get-video-info and get-audio-info need a program")
+            }
+        }
+    }
+}
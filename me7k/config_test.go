@@ -0,0 +1,140 @@
+package me7k
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+const sampleConfig = `# collector configuration
+user = "Admin"
+password = ""
+session-type = "pull"
+duration = "1m"
+
+[[device]]
+name = "horsham"
+endpoint = "https://10.10.55.163/neoreq/"
+farmer = "ME-7000-2"
+session-type = "push"
+device-events = [
+    "alarm-added", "alarm-cleared",   # alarms
+    "heartbeat-event",
+]
+
+[[device.bitrate]]
+board = "4"
+gige-line = "4/3"
+mux = "0000"
+get-streams = true
+get-std-dev = true
+get-inst-br = true
+get-avg-br = false
+
+[[device]]
+name = "san-diego"
+endpoint = 'https://10.77.6.12/neoreq/'
+user = "Operator"
+
+[[device.bitrate]]
+path = "ME-7000-1/4/4-3/0014/1"
+get-video-info = true
+`
+
+func TestParseConfig(t *testing.T) {
+    cfg, err := ParseConfig("collector.toml", sampleConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.Duration != time.Minute || len(cfg.Devices) != 2 {
+        t.Fatalf("parsed %+v", cfg)
+    }
+
+    h := cfg.Devices[0]
+    if h.Name != "horsham" || h.User != "Admin" || h.SessionType != SessionPush || h.Line != 7 {
+        t.Errorf("horsham %+v", h)
+    }
+    if len(h.DeviceEvents) != 3 || h.DeviceEvents[2] != HeartbeatEvent {
+        t.Errorf("horsham device events %v", h.DeviceEvents)
+    }
+    want := NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0000")
+    if len(h.BitRates) != 1 || h.BitRates[0].Path != want {
+        t.Fatalf("horsham bit rates %+v", h.BitRates)
+    }
+    if e := h.BitRates[0].Event; e.Type != BitRateEventType || e.GetStreams != "true" || e.GetAvgBr != "false" || e.GetVideoInfo != "" {
+        t.Errorf("horsham flags %+v", e)
+    }
+
+    s := cfg.Devices[1]
+    if s.User != "Operator" || s.SessionType != SessionPull || s.Endpoint != "https://10.77.6.12/neoreq/" {
+        t.Errorf("san-diego %+v", s)
+    }
+    if len(s.BitRates) != 1 || s.BitRates[0].Path.Level() != LevelOutputProgram || s.BitRates[0].Event.GetVideoInfo != "true" {
+        t.Errorf("san-diego bit rates %+v", s.BitRates)
+    }
+
+    o := h.Options(Options{Origin: "lab"})
+    if o.User != "Admin" || o.SessionType != SessionPush || o.Origin != "lab" {
+        t.Errorf("options %+v", o)
+    }
+}
+
+func TestConfigErrors(t *testing.T) {
+    for _, tc := range []struct {
+        src  string
+        want []string
+    }{
+        {"user = Admin\n", []string{`c.toml:1: bad value "Admin"; strings must be quoted`}},
+        {"user = \"Admin\"\n\n[[device]]\nname = \"a\"\nendpoint = \"https://x/neoreq/\"\nsesion-type = \"pull\"\n",
+            []string{`c.toml:6: unknown key "sesion-type" in [[device]]`}},
+        {"user = \"Admin\"\n[[device]]\nname = \"a\"\nendpoint = \"ftp://x\"\nsession-type = \"poll\"\ndevice-events = [\"alarm-raised\"]\n",
+            []string{`c.toml:2: endpoint "ftp://x" of device a is not an http(s) URL`,
+                `c.toml:5: session-type "poll" must be "pull" or "push"`,
+                `c.toml:6: unknown device event "alarm-raised"`}},
+        {"user = \"Admin\"\n[[device]]\nname = \"a\"\nendpoint = \"https://x/neoreq/\"\nfarmer = \"ME-7000-2\"\n" +
+            "[[device.bitrate]]\nboard = \"4\"\nmux = \"0000\"\n[[device.bitrate]]\nboard = \"4\"\nget-streams = \"yes\"\n",
+            []string{`c.toml:6: mux is set but gige-line is missing`,
+                `c.toml:11: get-streams must be true or false`,
+                `c.toml:9: bit rates are reported per gige-line, mux or program`}},
+        {"[[device.bitrate]]\nmux = \"0000\"\n", []string{`c.toml:1: [[device.bitrate]] must follow the [[device]]`, `c.toml: no [[device]]`}},
+        {"[device]\nname = \"a\"\n", []string{`c.toml:1: use [[device]], one per device`}},
+        {"name = \"a\"\n", []string{`c.toml:1: name must be set per [[device]]`}},
+        {"user = \"unterminated\n", []string{`c.toml:1: unterminated string`}},
+        {"x = [1,\n 2\n", []string{`c.toml:3: expected , or ] in array`}},
+        {"user = \"Admin\"\n[[device]]\nname = \"a\"\nendpoint = \"https://x/neoreq/\"\nknown-hosts = \"known_hosts\"\n" +
+            "fingerprints = [\"" + strings.Repeat("00", 32) + "\"]\n",
+            []string{`c.toml:2: device a: fingerprints and known-hosts cannot be combined`}},
+    } {
+        _, err := ParseConfig("c.toml", tc.src)
+        if err == nil {
+            t.Errorf("%q parsed without error", tc.src)
+            continue
+        }
+        for _, w := range tc.want {
+            if !strings.Contains(err.Error(), w) {
+                t.Errorf("%q:\ngot  %v\nwant %s", tc.src, err, w)
+            }
+        }
+    }
+}
+
+func TestConfigPinnedDevice(t *testing.T) {
+    cfg, err := ParseConfig("c.toml", "user = \"Admin\"\nknown-hosts = \"known_hosts\"\n"+
+        "[[device]]\nname = \"a\"\nendpoint = \"https://x/neoreq/\"\nfingerprints = [\""+strings.Repeat("00", 32)+"\"]\n"+
+        "[[device]]\nname = \"b\"\nendpoint = \"https://y/neoreq/\"\n")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if a := cfg.Devices[0].TLS; a.KnownHosts != "" || len(a.Fingerprints) != 1 {
+        t.Errorf("pinned device TLS %+v, want no known hosts", a)
+    }
+    if b := cfg.Devices[1].TLS; b.KnownHosts != "known_hosts" {
+        t.Errorf("device b TLS %+v, want the known hosts inherited", b)
+    }
+}
+
+func TestLoadExampleConfig(t *testing.T) {
+    if _, err := LoadConfig("../collector.toml"); err != nil {
+        t.Error(err)
+    }
+}
@@ -0,0 +1,169 @@
+package me7k
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "runtime"
+    "strings"
+    "time"
+)
+
+//
+// Credentials need not be written into the code or the configuration file.
+// With Options.Credentials set, every Login asks the source for the user and
+// password, so a rotated password is picked up on the next re-login. The
+// sources here read them from the environment, from a file only the owner
+// can read, or from the output of a helper command.
+//
+
+type Credentials struct {
+    User     string
+    Password string
+}
+
+// String leaves out the password, so Credentials can be logged.
+func (c Credentials) String() string {
+    return fmt.Sprintf("user %s, password %s", c.User, redactedPassword)
+}
+
+type CredentialSource interface {
+    Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialFunc adapts a function to a CredentialSource.
+type CredentialFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialFunc) Credentials(ctx context.Context) (Credentials, error) {
+    return f(ctx)
+}
+
+//
+// EnvCredentials reads the user and password from the environment variables
+// userVar and passwordVar. An unset user variable is an error, an unset
+// password variable an empty password; userVar "" keeps Options.User.
+//
+
+func EnvCredentials(userVar, passwordVar string) CredentialSource {
+    return CredentialFunc(func(ctx context.Context) (Credentials, error) {
+        var c Credentials
+        if userVar != "" {
+            u, ok := os.LookupEnv(userVar)
+            if !ok || u == "" {
+                return c, fmt.Errorf("EnvCredentials - %s is not set", userVar)
+            }
+            c.User = u
+        }
+        c.Password = os.Getenv(passwordVar)
+        return c, nil
+    })
+}
+
+//
+// FileCredentials reads the file name, which holds the user on its first line
+// and the password on the second. The file must not be readable by group or
+// others, like an ssh key.
+//
+
+func FileCredentials(name string) CredentialSource {
+    return CredentialFunc(func(ctx context.Context) (Credentials, error) {
+        fi, err := os.Stat(name)
+        if err != nil {
+            return Credentials{}, fmt.Errorf("FileCredentials - %v", err)
+        }
+        if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+            return Credentials{}, fmt.Errorf("FileCredentials - %s is accessible by others (mode %v), chmod 600 it", name, fi.Mode().Perm())
+        }
+        data, err := ioutil.ReadFile(name)
+        if err != nil {
+            return Credentials{}, fmt.Errorf("FileCredentials - %v", err)
+        }
+        c, err := parseCredentials(data)
+        if err != nil {
+            return c, fmt.Errorf("FileCredentials - %s: %v", name, err)
+        }
+        return c, nil
+    })
+}
+
+// DefaultCredentialCommandTimeout bounds a credential helper command.
+const DefaultCredentialCommandTimeout = 10 * time.Second
+
+//
+// CommandCredentials runs a helper, e.g. a password manager client, and reads
+// the user and password from its output in the format of FileCredentials.
+// The helper's error output is passed on in the error if it fails.
+//
+
+func CommandCredentials(name string, args ...string) CredentialSource {
+    return CredentialFunc(func(ctx context.Context) (Credentials, error) {
+        ctx, cancel := context.WithTimeout(ctx, DefaultCredentialCommandTimeout)
+        defer cancel()
+
+        cmd := exec.CommandContext(ctx, name, args...)
+        var stderr bytes.Buffer
+        cmd.Stderr = &stderr
+        out, err := cmd.Output()
+        if err != nil {
+            return Credentials{}, fmt.Errorf("CommandCredentials - %s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+        }
+        c, err := parseCredentials(out)
+        if err != nil {
+            return c, fmt.Errorf("CommandCredentials - output of %s: %v", name, err)
+        }
+        return c, nil
+    })
+}
+
+func parseCredentials(data []byte) (Credentials, error) {
+    lines := strings.SplitN(strings.TrimRight(string(data), "\r\n"), "\n", 3)
+    if len(lines) > 2 {
+        return Credentials{}, fmt.Errorf("expected the user and the password on two lines, got more")
+    }
+    c := Credentials{User: strings.TrimSpace(lines[0])}
+    if len(lines) == 2 {
+        c.Password = strings.TrimRight(lines[1], "\r") // a password may start or end with blanks
+    }
+    if c.User == "" {
+        return c, fmt.Errorf("no user on the first line")
+    }
+    return c, nil
+}
+
+//
+// credentials returns the user and password to log in with, asking
+// Options.Credentials if set, and remembers them for Sessions and reclaim.
+//
+
+func (c *Client) credentials(ctx context.Context) (Credentials, error) {
+    cred := Credentials{User: c.opts.User, Password: c.opts.Password}
+    if c.opts.Credentials != nil {
+        got, err := c.opts.Credentials.Credentials(ctx)
+        if err != nil {
+            return cred, err
+        }
+        if got.User != "" {
+            cred.User = got.User
+        }
+        cred.Password = got.Password
+    }
+    c.redact.addSecret(cred.Password, redactedPassword)
+
+    c.mu.Lock()
+    c.user = cred.User
+    c.mu.Unlock()
+    return cred, nil
+}
+
+// userName returns the user of the last login, or Options.User before it.
+func (c *Client) userName() string {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.user != "" {
+        return c.user
+    }
+    return c.opts.User
+}
@@ -0,0 +1,103 @@
+package me7k
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "testing"
+)
+
+func TestCredentialSources(t *testing.T) {
+    ctx := context.Background()
+
+    t.Setenv("TEST_ME7K_USER", "Operator")
+    t.Setenv("TEST_ME7K_PASSWORD", "s3cret!")
+    c, err := EnvCredentials("TEST_ME7K_USER", "TEST_ME7K_PASSWORD").Credentials(ctx)
+    if err != nil || c.User != "Operator" || c.Password != "s3cret!" {
+        t.Errorf("env: %v, %v", c, err)
+    }
+    if _, err := EnvCredentials("TEST_ME7K_UNSET", "").Credentials(ctx); err == nil {
+        t.Error("env: unset user accepted")
+    }
+
+    name := filepath.Join(t.TempDir(), "admin")
+    if err := ioutil.WriteFile(name, []byte("Admin\n pass word \n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    c, err = FileCredentials(name).Credentials(ctx)
+    if err != nil || c.User != "Admin" || c.Password != " pass word " {
+        t.Errorf("file: %q, %v", c.Password, err)
+    }
+    if runtime.GOOS != "windows" {
+        os.Chmod(name, 0644)
+        if _, err := FileCredentials(name).Credentials(ctx); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+            t.Errorf("file readable by others: %v", err)
+        }
+    }
+
+    if runtime.GOOS != "windows" {
+        c, err = CommandCredentials("sh", "-c", `printf 'Admin\nfrom-helper\n'`).Credentials(ctx)
+        if err != nil || c.User != "Admin" || c.Password != "from-helper" {
+            t.Errorf("command: %v, %v", c, err)
+        }
+        if _, err := CommandCredentials("sh", "-c", "echo locked >&2; exit 1").Credentials(ctx); err == nil || !strings.Contains(err.Error(), "locked") {
+            t.Errorf("failing command: %v", err)
+        }
+    }
+
+    if s := fmt.Sprint(Credentials{"Admin", "s3cret!"}); strings.Contains(s, "s3cret") {
+        t.Errorf("Credentials print their password: %s", s)
+    }
+}
+
+func TestLogsAreRedacted(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        if bytes.Contains(body, []byte(`command="add" category="login"`)) {
+            if !bytes.Contains(body, []byte(`password="s3cret!"`)) {
+                t.Errorf("password not sent: %s", body)
+            }
+            fmt.Fprint(w, `<response command="add" category="login"><session sid="949098745790" type="pull"/></response>`)
+            return
+        }
+        fmt.Fprint(w, `<response command="get" category="event" status="error"><reason error-code="Unknown_Error">`+
+            `<![CDATA[Invalid session id 949098745790.]]></reason></response>`)
+    }))
+    defer srv.Close()
+
+    t.Setenv("TEST_ME7K_PASSWORD", "s3cret!")
+    var out bytes.Buffer
+    c, _ := NewClient(srv.URL, Options{User: "Admin", Credentials: EnvCredentials("", "TEST_ME7K_PASSWORD"),
+        Logger: log.New(&out, "", 0), DisableKeepAlive: true, DisableRelogin: true})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    _, err := c.GetEvents(context.Background())
+    if err == nil {
+        t.Fatal("expected an invalid session error")
+    }
+    if got := c.Redact(err.Error()); strings.Contains(got, "949098745790") || !strings.Contains(got, "********5790") {
+        t.Errorf("Redact(%q) = %q", err, got)
+    }
+    c.log.Printf("Test - lost %s", c.sessionId())
+
+    logged := out.String()
+    for _, secret := range []string{"s3cret!", "949098745790"} {
+        if strings.Contains(logged, secret) {
+            t.Errorf("log shows %s:\n%s", secret, logged)
+        }
+    }
+    for _, want := range []string{`password="*****"`, `sid="********5790"`, "Invalid session id ********5790."} {
+        if !strings.Contains(logged, want) {
+            t.Errorf("log lacks %s:\n%s", want, logged)
+        }
+    }
+}
@@ -0,0 +1,150 @@
+package me7k
+
+import (
+    "context"
+    "fmt"
+)
+
+//
+// Event types a device-wide subscription can ask for, see the device wide
+// subscription request in messages.go. Bit rate events are not device wide,
+// they are subscribed per line, mux or program with Subscribe.
+//
+
+type DeviceEventType string
+
+const (
+    AlarmSettingsEvent        DeviceEventType = "alarm-settings-event"
+    ConfigurationEvent        DeviceEventType = "configuration-event"
+    DbStatusEvent             DeviceEventType = "db-status-event"
+    HeartbeatEvent            DeviceEventType = "heartbeat-event"
+    ScheduleNotificationEvent DeviceEventType = "schedule-notification-event"
+    SecurityEvent             DeviceEventType = "security-event"
+    LicenseEvent              DeviceEventType = "license-event"
+    AlarmAddedEvent           DeviceEventType = "alarm-added-event"
+    AlarmDeletedEvent         DeviceEventType = "alarm-deleted-event"
+    AlarmClearedEvent         DeviceEventType = "alarm-cleared-event"
+    SwUpdateEvent             DeviceEventType = "sw-update-event"
+)
+
+// AllDeviceEvents lists every device-wide event type in the order the device documents them.
+var AllDeviceEvents = []DeviceEventType{
+    AlarmSettingsEvent, ConfigurationEvent, DbStatusEvent, HeartbeatEvent, ScheduleNotificationEvent,
+    SecurityEvent, LicenseEvent, AlarmAddedEvent, AlarmDeletedEvent, AlarmClearedEvent, SwUpdateEvent,
+}
+
+// Valid reports whether t is one of AllDeviceEvents.
+func (t DeviceEventType) Valid() bool {
+    for _, a := range AllDeviceEvents {
+        if t == a {
+            return true
+        }
+    }
+    return false
+}
+
+//
+// SubscribeDevice subscribes to the device-wide events of farmer listed in
+// types, all in one request. Types already subscribed stay subscribed.
+//
+
+func (c *Client) SubscribeDevice(ctx context.Context, farmer string, types ...DeviceEventType) error {
+    if err := checkDeviceEvents(types); err != nil {
+        return fmt.Errorf("SubscribeDevice - %v", err)
+    }
+    if err := c.call(ctx, "SubscribeDevice", c.deviceRequest("add", farmer, types), nil); err != nil {
+        return err
+    }
+    c.updateDeviceSubscription(farmer, types, nil)
+    return nil
+}
+
+//
+// UnsubscribeDevice removes the listed device-wide event types of farmer, or
+// every type subscribed so far if none are listed.
+//
+
+func (c *Client) UnsubscribeDevice(ctx context.Context, farmer string, types ...DeviceEventType) error {
+    if len(types) == 0 {
+        types = c.deviceSubscription(farmer)
+        if len(types) == 0 {
+            return nil
+        }
+    }
+    if err := checkDeviceEvents(types); err != nil {
+        return fmt.Errorf("UnsubscribeDevice - %v", err)
+    }
+    if err := c.call(ctx, "UnsubscribeDevice", c.deviceRequest("remove", farmer, types), nil); err != nil {
+        return err
+    }
+    c.updateDeviceSubscription(farmer, nil, types)
+    return nil
+}
+
+func checkDeviceEvents(types []DeviceEventType) error {
+    if len(types) == 0 {
+        return fmt.Errorf("no event types")
+    }
+    for _, t := range types {
+        if !t.Valid() {
+            return fmt.Errorf("%q is not a device-wide event type", t)
+        }
+    }
+    return nil
+}
+
+func (c *Client) deviceRequest(command, farmer string, types []DeviceEventType) *DeviceRequest {
+    d := &DeviceRequest{Envelope: c.envelope(command, "subscription")}
+    d.Path = NewPath(farmer)
+    for _, t := range types {
+        d.DeviceEvent.Events = append(d.DeviceEvent.Events, DeviceEventItem{Type: t})
+    }
+    return d
+}
+
+func (c *Client) deviceSubscription(farmer string) []DeviceEventType {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.subs["device:"+farmer].events
+}
+
+//
+// updateDeviceSubscription records that add were subscribed and del removed,
+// keeping one subscription per farmer that replays the whole set.
+//
+
+func (c *Client) updateDeviceSubscription(farmer string, add, del []DeviceEventType) {
+    key := "device:" + farmer
+
+    c.mu.Lock()
+    set := make(map[DeviceEventType]bool)
+    for _, t := range c.subs[key].events {
+        set[t] = true
+    }
+    c.mu.Unlock()
+
+    for _, t := range add {
+        set[t] = true
+    }
+    for _, t := range del {
+        delete(set, t)
+    }
+
+    var events []DeviceEventType
+    for _, t := range AllDeviceEvents {
+        if set[t] {
+            events = append(events, t)
+        }
+    }
+    if len(events) == 0 {
+        c.removeSubscription(key)
+        return
+    }
+
+    c.addSubscription(key, subscription{
+        name:   "device subscription " + farmer,
+        add:    func() request { return c.deviceRequest("add", farmer, events) },
+        remove: func() request { return c.deviceRequest("remove", farmer, events) },
+        events: events,
+    })
+}
@@ -0,0 +1,101 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func TestDeviceRequestMarshal(t *testing.T) {
+    c, _ := NewClient("http://device", Options{})
+    out, err := Marshal(c.deviceRequest("add", "ME-7000-2", []DeviceEventType{HeartbeatEvent, AlarmAddedEvent}))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := `<path><farmer id="ME-7000-2"/></path><event-list><event type="heartbeat-event"/><event type="alarm-added-event"/></event-list>`
+    if !strings.Contains(string(out), want) {
+        t.Errorf("got %s\nwant it to contain %s", out, want)
+    }
+}
+
+func TestSubscribeDeviceSubset(t *testing.T) {
+    var mu sync.Mutex
+    var sent [][]DeviceEventType
+    refuse := false
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var req DeviceRequest
+        xml.Unmarshal(body, &req)
+        mu.Lock()
+        refused := refuse && req.Command == "remove"
+        mu.Unlock()
+        if refused {
+            fmt.Fprint(w, `<response command="remove" category="subscription" status="error">`+
+                `<reason error-code="Unknown_Error"><![CDATA[The path does not exist.]]></reason></response>`)
+            return
+        }
+        if req.Category == "subscription" {
+            var types []DeviceEventType
+            for _, e := range req.DeviceEvent.Events {
+                types = append(types, e.Type)
+            }
+            mu.Lock()
+            sent = append(sent, types)
+            mu.Unlock()
+        }
+        fmt.Fprintf(w, `<response command="%s" category="%s"><reason error-code="OK">succeeded.</reason></response>`, req.Command, req.Category)
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{})
+    if err := c.SubscribeDevice(context.Background(), "ME-7000-2", AlarmAddedEvent, AlarmClearedEvent, HeartbeatEvent); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.UnsubscribeDevice(context.Background(), "ME-7000-2", HeartbeatEvent); err != nil {
+        t.Fatal(err)
+    }
+    if got, want := c.deviceSubscription("ME-7000-2"), []DeviceEventType{AlarmAddedEvent, AlarmClearedEvent}; !reflect.DeepEqual(got, want) {
+        t.Errorf("still subscribed %v, want %v", got, want)
+    }
+
+    mu.Lock()
+    refuse = true
+    mu.Unlock()
+    if err := c.UnsubscribeDevice(context.Background(), "ME-7000-2", AlarmClearedEvent); err == nil {
+        t.Fatal("refused UnsubscribeDevice succeeded")
+    }
+    if got := c.deviceSubscription("ME-7000-2"); len(got) != 2 {
+        t.Errorf("subscribed %v after a refused remove, want both alarm events kept", got)
+    }
+    mu.Lock()
+    refuse = false
+    mu.Unlock()
+
+    if err := c.UnsubscribeDevice(context.Background(), "ME-7000-2"); err != nil {
+        t.Fatal(err)
+    }
+    if got := c.deviceSubscription("ME-7000-2"); got != nil {
+        t.Errorf("still subscribed %v after removing all", got)
+    }
+
+    want := [][]DeviceEventType{
+        {AlarmAddedEvent, AlarmClearedEvent, HeartbeatEvent},
+        {HeartbeatEvent},
+        {AlarmAddedEvent, AlarmClearedEvent},
+    }
+    if !reflect.DeepEqual(sent, want) {
+        t.Errorf("sent %v, want %v", sent, want)
+    }
+
+    if err := c.SubscribeDevice(context.Background(), "ME-7000-2", BitRateEventType); err == nil {
+        t.Error("bit-rate-event accepted as a device-wide event")
+    }
+}
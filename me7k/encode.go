@@ -0,0 +1,94 @@
+package me7k
+
+import (
+    "bytes"
+    "encoding/xml"
+    "io"
+)
+
+//
+// The me7k writes and expects self closing tags, e.g. <farmer id="ME-7000-2"/>,
+// but encoding/xml always emits an explicit close tag. Marshal re-writes the
+// output of xml.Marshal one token at a time and collapses every element that
+// has neither children nor text into its self closing form.
+//
+
+// Marshal returns the XML encoding of v with empty elements self closed.
+func Marshal(v interface{}) ([]byte, error) {
+    raw, err := xml.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return selfClose(raw)
+}
+
+func selfClose(raw []byte) ([]byte, error) {
+    var out bytes.Buffer
+
+    d := xml.NewDecoder(bytes.NewReader(raw))
+    pending := false // a start tag has been written without its closing '>'
+
+    for {
+        tok, err := d.RawToken()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        if _, end := tok.(xml.EndElement); end && pending {
+            out.WriteString("/>") // nothing between start and end: self close
+            pending = false
+            continue
+        }
+        if pending {
+            out.WriteByte('>')
+            pending = false
+        }
+
+        switch t := tok.(type) {
+        case xml.StartElement:
+            out.WriteByte('<')
+            writeName(&out, t.Name)
+            for _, a := range t.Attr {
+                out.WriteByte(' ')
+                writeName(&out, a.Name)
+                out.WriteString(`="`)
+                xml.EscapeText(&out, []byte(a.Value))
+                out.WriteByte('"')
+            }
+            pending = true
+        case xml.EndElement:
+            out.WriteString("</")
+            writeName(&out, t.Name)
+            out.WriteByte('>')
+        case xml.CharData:
+            xml.EscapeText(&out, t)
+        case xml.Comment:
+            out.WriteString("<!--")
+            out.Write(t)
+            out.WriteString("-->")
+        case xml.ProcInst:
+            out.WriteString("<?" + t.Target)
+            if len(t.Inst) > 0 {
+                out.WriteByte(' ')
+                out.Write(t.Inst)
+            }
+            out.WriteString("?>")
+        case xml.Directive:
+            out.WriteString("<!")
+            out.Write(t)
+            out.WriteByte('>')
+        }
+    }
+
+    return out.Bytes(), nil
+}
+
+func writeName(out *bytes.Buffer, n xml.Name) {
+    if n.Space != "" {
+        out.WriteString(n.Space + ":") // RawToken leaves the prefix in Space
+    }
+    out.WriteString(n.Local)
+}
@@ -0,0 +1,114 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "reflect"
+    "testing"
+)
+
+//
+// Request samples from the comments in messages.go, with the typos of the
+// source document ("protocol- version", curly quotes) fixed.
+//
+
+const (
+    sampleLoginRequest = `<request id="G1000" origin="gui" destination="device" command="add" category="login" ` +
+        `time="2015-03-09T17:38:09.783-06:00" protocol-version="2.3" platform-name="neo">` +
+        `<user name="Admin" password="" type="push"/>` +
+        `</request>`
+
+    sampleAddBitRateRequest = `<request id="G1201" origin="gui" destination="device" command="add" category="subscription" ` +
+        `time="2016-02-09T11:30:20.508-06:00" protocol-version="2.3" platform-name="neo" sid="9223370581815793597">` +
+        `<path><farmer id="ME-7000-2"/><board id="4"/><gige-line id="4/3"/><gige-output-mux id="0014"/></path>` +
+        `<event-list><event type="bit-rate-event" get-streams="true" get-std-dev="true" get-inst-br="true" get-avg-br="true"/></event-list>` +
+        `</request>`
+
+    sampleRemoveBitRateRequest = `<request id="G1204" origin="gui" destination="device" command="remove" category="subscription" ` +
+        `time="2016-02-09T11:32:20.177-06:00" protocol-version="2.3" platform-name="neo" sid="9223370581815793597">` +
+        `<path><farmer id="ME-7000-2"/><board id="4"/><gige-line id="4/3"/><gige-output-mux id="0014"/></path>` +
+        `<event-list><event type="bit-rate-event"/></event-list>` +
+        `</request>`
+
+    sampleGetEventRequest = `<request id="G1111" origin="gui" destination="device" command="get" category="event" ` +
+        `time="2015-06-26T16:37:59.491Z" protocol-version="1.0" platform-name="neo" sid="1435336628026"/>`
+
+    sampleRemoveLoginRequest = `<request id="G1037" origin="gui" destination="device" command="remove" category="login" ` +
+        `time="2015-03-09T17:38:29.783-06:00" protocol-version="2.3" platform-name="neo" sid="949098745790"/>`
+)
+
+func TestMarshalRequestSamples(t *testing.T) {
+    path := NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014")
+    env := func(id, command, category, time, version, sid string) Envelope {
+        return Envelope{Id: id, Origin: "gui", Destination: "device", Command: command, Category: category,
+            Time: time, Version: version, Platform: "neo", SessionId: sid}
+    }
+
+    tests := []struct {
+        name string
+        v    interface{}
+        want string
+    }{
+        {"login", &LoginRequest{
+            Envelope: env("G1000", "add", "login", "2015-03-09T17:38:09.783-06:00", "2.3", ""),
+            User:     User{Name: "Admin", Password: "", Type: "push"},
+        }, sampleLoginRequest},
+        {"add bitrate", &BitRateRequest{
+            Envelope: env("G1201", "add", "subscription", "2016-02-09T11:30:20.508-06:00", "2.3", "9223370581815793597"),
+            Path:     path,
+            Event:    Event{EventBitRate: EventBitRate{Type: "bit-rate-event", GetStreams: "true", GetStdDev: "true", GetInstBr: "true", GetAvgBr: "true"}},
+        }, sampleAddBitRateRequest},
+        {"remove bitrate", &BitRateRequest{
+            Envelope: env("G1204", "remove", "subscription", "2016-02-09T11:32:20.177-06:00", "2.3", "9223370581815793597"),
+            Path:     path,
+            Event:    Event{EventBitRate: EventBitRate{Type: "bit-rate-event"}},
+        }, sampleRemoveBitRateRequest},
+        {"get event", &EventRequest{
+            Envelope: env("G1111", "get", "event", "2015-06-26T16:37:59.491Z", "1.0", "1435336628026"),
+        }, sampleGetEventRequest},
+        {"remove login", &RemoveLoginRequest{
+            Envelope: env("G1037", "remove", "login", "2015-03-09T17:38:29.783-06:00", "2.3", "949098745790"),
+        }, sampleRemoveLoginRequest},
+    }
+
+    for _, tt := range tests {
+        got, err := Marshal(tt.v)
+        if err != nil {
+            t.Errorf("%s: Marshal: %v", tt.name, err)
+            continue
+        }
+        if string(got) != tt.want {
+            t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+        }
+
+        // and back again
+        back := reflect.New(reflect.TypeOf(tt.v).Elem()).Interface()
+        if err := xml.Unmarshal(got, back); err != nil {
+            t.Errorf("%s: Unmarshal: %v", tt.name, err)
+            continue
+        }
+        again, err := Marshal(back)
+        if err != nil || string(again) != tt.want {
+            t.Errorf("%s: round trip:\n got %s (%v)\nwant %s", tt.name, again, err, tt.want)
+        }
+    }
+}
+
+func TestSelfCloseKeepsContent(t *testing.T) {
+    tests := []struct{ in, want string }{
+        {`<a></a>`, `<a/>`},
+        {`<a x="1"><b></b><c y="&lt;&amp;&#34;"></c></a>`, `<a x="1"><b/><c y="&lt;&amp;&#34;"/></a>`},
+        {`<reason error-code="OK">succeeded.</reason>`, `<reason error-code="OK">succeeded.</reason>`},
+        {`<a> </a>`, `<a> </a>`},
+        {`<a><![CDATA[x < y]]></a>`, `<a>x &lt; y</a>`},
+    }
+    for _, tt := range tests {
+        got, err := selfClose([]byte(tt.in))
+        if err != nil {
+            t.Errorf("selfClose(%s): %v", tt.in, err)
+            continue
+        }
+        if string(got) != tt.want {
+            t.Errorf("selfClose(%s) = %s, want %s", tt.in, got, tt.want)
+        }
+    }
+}
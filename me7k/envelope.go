@@ -0,0 +1,116 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "fmt"
+    "sync/atomic"
+    "time"
+)
+
+/*
+ * General format for request:
+ *
+ * <request id="any-id" origin="client" destination="device" command="get" category="config"
+ * time="2015-03-09T17:38:09.783-06:00" protocol- version=“2.3” platform-name="neo"
+ * sid="unique-session-id" [additional attributes]>
+ * <path>
+ * <elements defining the path to target object>
+ * </path>
+ * <elements and attributes for the target object/>
+ * </request>
+ *
+ * Responses echo the same attributes and add sw-version, sw-build and, depending
+ * on the category, status and pending-events.
+ */
+
+//
+// Envelope holds the attributes shared by every request and response. It is
+// embedded in each message type so its fields marshal as attributes of the
+// enclosing <request> or <response> element.
+//
+
+type Envelope struct {
+    Id          string `xml:"id,attr"`
+    Origin      string `xml:"origin,attr"`
+    Destination string `xml:"destination,attr"`
+    Command     string `xml:"command,attr"`
+    Category    string `xml:"category,attr"`
+    Time        string `xml:"time,attr"`
+    Version     string `xml:"protocol-version,attr"`
+    Platform    string `xml:"platform-name,attr"`
+    SessionId   string `xml:"sid,attr,omitempty"` // not sent with the login request
+}
+
+//
+// ResponseEnvelope is the Envelope of a <response>, plus the attributes the
+// device adds to every reply.
+//
+
+type ResponseEnvelope struct {
+    Envelope
+    SwVersion     string `xml:"sw-version,attr"`
+    SwBuild       string `xml:"sw-build,attr"`
+    Status        string `xml:"status,attr,omitempty"`         // "error" on failure, otherwise usually absent
+    PendingEvents int    `xml:"pending-events,attr,omitempty"` // events still queued after a get event
+}
+
+// Response is a reply that carries nothing but a reason, e.g. for subscriptions.
+type Response struct {
+    XMLName xml.Name `xml:"response"`
+    ResponseEnvelope
+    Reason Reason `xml:"reason"`
+}
+
+//
+// Time format documented by the protocol: ISO-8601 with milliseconds and a
+// numeric zone, e.g. 2015-03-09T17:38:09.783-06:00
+//
+
+const TimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// FormatTime formats t the way the device expects in the time attribute.
+func FormatTime(t time.Time) string {
+    return t.Format(TimeLayout)
+}
+
+// ParseTime parses a time attribute sent by the device.
+func ParseTime(s string) (time.Time, error) {
+    t, err := time.Parse(TimeLayout, s)
+    if err != nil {
+        t, err = time.Parse(time.RFC3339Nano, s)
+    }
+    if err != nil {
+        return time.Time{}, fmt.Errorf("ParseTime - bad time %q", s)
+    }
+    return t, nil
+}
+
+//
+// Request ids are a prefix followed by a sequence number shared by every
+// Client in the process, so ids are unique and increase monotonically even
+// when several Clients talk to the same device.
+//
+
+var requestSeq uint64 = 999
+
+func nextRequestId(prefix string) string {
+    return fmt.Sprintf("%s%d", prefix, atomic.AddUint64(&requestSeq, 1))
+}
+
+//
+// envelope fills the common attributes for a request sent by c.
+//
+
+func (c *Client) envelope(command, category string) Envelope {
+    return Envelope{
+        Id:          nextRequestId(c.opts.RequestIdPrefix),
+        Origin:      c.opts.Origin,
+        Destination: "device",
+        Command:     command,
+        Category:    category,
+        Time:        FormatTime(time.Now()),
+        Version:     c.protocolVersion(),
+        Platform:    c.opts.Platform,
+        SessionId:   c.sessionId(),
+    }
+}
@@ -0,0 +1,90 @@
+package me7k
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+/*
+ * Format of an error response:
+ *
+ * <response id="beacham" origin="device" destination="transcoder-collector" command="add" category="login"
+ * time="2017-08-30T23:24:54.900Z" protocol-version="2.1" platform-name="neo" sw-version="me7k.2.1.2"
+ * sw-build="0" status="error"><reason error-code="Unknown_Error"><![CDATA[Number of sessions exceeded
+ * the maximum of 8.]]></reason></response>
+ */
+
+//
+// Conditions callers commonly need to react to. A *NeoError matches one of
+// these with errors.Is when its error code or message identifies it.
+//
+
+var (
+    ErrSessionLimit   = errors.New("session limit exceeded")
+    ErrInvalidSession = errors.New("invalid session id")
+    ErrUnknownPath    = errors.New("unknown path")
+)
+
+//
+// NeoError is a request the device answered with status="error" or with a
+// reason error-code other than "OK".
+//
+
+type NeoError struct {
+    Category string // category of the failed request, e.g. "login"
+    Command  string // command of the failed request, e.g. "add"
+    Code     string // error-code attribute of <reason>
+    Message  string // text of <reason>
+
+    kind error // sentinel matched by Code or Message, may be nil
+}
+
+func (e *NeoError) Error() string {
+    return fmt.Sprintf("%s %s failed: %s: %s", e.Command, e.Category, e.Code, e.Message)
+}
+
+// Is reports whether e is the condition described by one of the sentinel errors.
+func (e *NeoError) Is(target error) bool {
+    return e.kind != nil && e.kind == target
+}
+
+//
+// The device reports failures as "Unknown_Error", so only the message tells
+// them apart. The session limit message is the documented one above, the
+// other two are assumed. A session error must name the session id, so that
+// refusals merely mentioning a session, e.g. an invalid session type, are
+// not taken for a lost session and answered with a new login.
+//
+
+var neoErrorKinds = []struct {
+    kind    error
+    message *regexp.Regexp
+}{
+    {ErrSessionLimit, regexp.MustCompile(`(?i)number of sessions exceeded`)},
+    {ErrInvalidSession, regexp.MustCompile(`(?i)(invalid|unknown|expired) (session id|sid)\b`)},
+    {ErrUnknownPath, regexp.MustCompile(`(?i)(invalid|unknown) path|path\b.*\b(invalid|not found|does not exist)`)},
+}
+
+func newNeoError(category, command, code, message string) *NeoError {
+    e := &NeoError{Category: category, Command: command, Code: code, Message: strings.TrimSpace(message)}
+    for _, k := range neoErrorKinds {
+        if k.message.MatchString(e.Message) {
+            e.kind = k.kind
+            return e
+        }
+    }
+    return e
+}
+
+//
+// Err returns the *NeoError carried by the response, or nil if the request succeeded.
+//
+
+func (r *Response) Err() error {
+    if r.Status != "error" && (r.Reason.Code == "" || r.Reason.Code == "OK") {
+        return nil
+    }
+    return newNeoError(r.Category, r.Command, r.Reason.Code, r.Reason.Message)
+}
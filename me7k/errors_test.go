@@ -0,0 +1,65 @@
+package me7k
+
+import (
+    "errors"
+    "testing"
+)
+
+const sampleSessionLimitResponse = `<?xml version="1.0" encoding="UTF-8"?><response id="beacham" origin="device" ` +
+    `destination="transcoder-collector" command="add" category="login" time="2017-08-30T23:24:54.900Z" ` +
+    `protocol-version="2.1" platform-name="neo" sw-version="me7k.2.1.2" sw-build="0" status="error">` +
+    `<reason error-code="Unknown_Error"><![CDATA[Number of sessions exceeded the maximum of 8.]]></reason></response>`
+
+func TestDecodeErrorResponse(t *testing.T) {
+    err := decodeResponse("Login", []byte(sampleSessionLimitResponse), &LoginResponse{})
+
+    var ne *NeoError
+    if !errors.As(err, &ne) {
+        t.Fatalf("got %v, want a *NeoError", err)
+    }
+    if ne.Category != "login" || ne.Command != "add" || ne.Code != "Unknown_Error" ||
+        ne.Message != "Number of sessions exceeded the maximum of 8." {
+        t.Errorf("got %+v", ne)
+    }
+    if !errors.Is(err, ErrSessionLimit) {
+        t.Errorf("errors.Is(%v, ErrSessionLimit) = false", err)
+    }
+    if errors.Is(err, ErrInvalidSession) || errors.Is(err, ErrUnknownPath) {
+        t.Errorf("%v matches the wrong sentinel", err)
+    }
+}
+
+func TestDecodeOKResponse(t *testing.T) {
+    ok := `<response id="G1204" origin="device" destination="gui" command="remove" category="subscription" ` +
+        `time="2016-02-09T17:32:20.256Z" protocol-version="2.3" platform-name="neo" sw-version="me7k.2.2.0" ` +
+        `sw-build="1" sid="9223370581815793597"><reason error-code="OK"><![CDATA[unsuscribe completed.]]></reason></response>`
+
+    r := Response{}
+    if err := decodeResponse("Unsubscribe", []byte(ok), &r); err != nil {
+        t.Fatal(err)
+    }
+    if r.SwVersion != "me7k.2.2.0" || r.Reason.Message != "unsuscribe completed." {
+        t.Errorf("got %+v", r)
+    }
+}
+
+func TestNeoErrorKinds(t *testing.T) {
+    tests := []struct {
+        code, message string
+        want          error
+    }{
+        {"Unknown_Error", "Invalid session id 949098745790.", ErrInvalidSession},
+        {"Unknown_Error", "Invalid session type \"poll\".", nil},
+        {"Unknown_Error", "Session limit reached, path not found.", ErrUnknownPath},
+        {"Unknown_Error", "The path does not exist.", ErrUnknownPath},
+        {"Unknown_Error", "Something else broke.", nil},
+    }
+    for _, tt := range tests {
+        e := newNeoError("subscription", "add", tt.code, tt.message)
+        for _, s := range []error{ErrSessionLimit, ErrInvalidSession, ErrUnknownPath} {
+            if got := errors.Is(e, s); got != (s == tt.want) {
+                t.Errorf("errors.Is(%v, %v) = %v", e, s, got)
+            }
+        }
+    }
+}
@@ -0,0 +1,223 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "fmt"
+    "sync"
+    "time"
+)
+
+/*
+ * Device-wide events carry their details as attributes of the <event> element, e.g.
+ *
+ * <event type="alarm-deleted-event" id="1435265291353"/>
+ * <event type="alarm-cleared-event" id="1435316297245" cleared-time="2015-06-26T16:38:02.513Z"/>
+ *
+ * For alarm events the id is the id of the alarm. Attributes and elements not decoded into the
+ * Go type of an event stay available in its EventHeader.
+ */
+
+//
+// DecodedEvent is an event decoded according to its type: one of the types
+// below, a *BitRateEvent or an *UnknownEvent.
+//
+
+type DecodedEvent interface {
+    Kind() string // the type attribute of the event
+}
+
+//
+// EventHeader holds what every event has in common. Attrs are the attributes
+// of the <event> element other than type, id and time, Inner its body.
+//
+
+type EventHeader struct {
+    Type    string
+    Id      string
+    Created time.Time // from the id, zero if the id is not a time
+    Time    time.Time // zero if the device sent no time
+    Attrs   []xml.Attr
+    Inner   []byte
+}
+
+func (h *EventHeader) Kind() string {
+    return h.Type
+}
+
+// Attr returns the value of the attribute name, or "" if the event does not have it.
+func (h *EventHeader) Attr(name string) string {
+    for _, a := range h.Attrs {
+        if a.Name.Local == name {
+            return a.Value
+        }
+    }
+    return ""
+}
+
+type AlarmAdded struct {
+    EventHeader
+    Severity    string // severity attribute, e.g. "critical"; assumed, no documented sample has it
+    Description string // description attribute, assumed as well
+}
+
+type AlarmCleared struct {
+    EventHeader
+    ClearedTime time.Time
+}
+
+type AlarmDeleted struct{ EventHeader }
+type AlarmSettings struct{ EventHeader }
+type Heartbeat struct{ EventHeader }
+type Configuration struct{ EventHeader }
+type DbStatus struct{ EventHeader }
+type Security struct{ EventHeader }
+type License struct{ EventHeader }
+type ScheduleNotification struct{ EventHeader }
+type SwUpdate struct{ EventHeader }
+
+// SessionGap is the decoded form of a GapEventType event.
+type SessionGap struct{ EventHeader }
+
+//
+// UnknownEvent is an event of a type this package does not know, for example
+// from newer firmware. Raw is the whole <event> element.
+//
+
+type UnknownEvent struct {
+    EventHeader
+    Raw []byte
+}
+
+// eventDecoders turns the header of an event into its Go type, by event type.
+var eventDecoders = map[string]func(h EventHeader) (DecodedEvent, error){
+    string(AlarmAddedEvent): func(h EventHeader) (DecodedEvent, error) {
+        return &AlarmAdded{EventHeader: h, Severity: h.Attr("severity"), Description: h.Attr("description")}, nil
+    },
+    string(AlarmClearedEvent): func(h EventHeader) (DecodedEvent, error) {
+        a := &AlarmCleared{EventHeader: h}
+        if v := h.Attr("cleared-time"); v != "" {
+            t, err := ParseTime(v)
+            if err != nil {
+                return nil, fmt.Errorf("Decode - bad cleared-time of event %s: %v", h.Id, err)
+            }
+            a.ClearedTime = t
+        }
+        return a, nil
+    },
+    string(AlarmDeletedEvent):         func(h EventHeader) (DecodedEvent, error) { return &AlarmDeleted{h}, nil },
+    string(AlarmSettingsEvent):        func(h EventHeader) (DecodedEvent, error) { return &AlarmSettings{h}, nil },
+    string(HeartbeatEvent):            func(h EventHeader) (DecodedEvent, error) { return &Heartbeat{h}, nil },
+    string(ConfigurationEvent):        func(h EventHeader) (DecodedEvent, error) { return &Configuration{h}, nil },
+    string(DbStatusEvent):             func(h EventHeader) (DecodedEvent, error) { return &DbStatus{h}, nil },
+    string(SecurityEvent):             func(h EventHeader) (DecodedEvent, error) { return &Security{h}, nil },
+    string(LicenseEvent):              func(h EventHeader) (DecodedEvent, error) { return &License{h}, nil },
+    string(ScheduleNotificationEvent): func(h EventHeader) (DecodedEvent, error) { return &ScheduleNotification{h}, nil },
+    string(SwUpdateEvent):             func(h EventHeader) (DecodedEvent, error) { return &SwUpdate{h}, nil },
+    GapEventType:                      func(h EventHeader) (DecodedEvent, error) { return &SessionGap{h}, nil },
+}
+
+//
+// Decode decodes e according to its type. An event of an unknown type is
+// returned as an *UnknownEvent rather than an error.
+//
+
+func (e *EventType) Decode() (DecodedEvent, error) {
+    if e.Type == BitRateEventType {
+        return e.BitRate()
+    }
+
+    h := EventHeader{Type: e.Type, Id: e.Id, Attrs: e.Attrs, Inner: e.Inner}
+    h.Created, _ = EventIdTime(e.Id) // not every event id is a time
+    if e.Time != "" {
+        t, err := ParseTime(e.Time)
+        if err != nil {
+            return nil, fmt.Errorf("Decode - bad time of event %s: %v", e.Id, err)
+        }
+        h.Time = t
+    }
+
+    if decode, ok := eventDecoders[e.Type]; ok {
+        return decode(h)
+    }
+    raw, err := xml.Marshal(e)
+    if err != nil {
+        return nil, fmt.Errorf("Decode - Marshal error on event %s: %v", e.Id, err)
+    }
+    return &UnknownEvent{EventHeader: h, Raw: raw}, nil
+}
+
+//
+// EventHandlers dispatches events to one handler per event type. Events of a
+// type without a handler are dropped, except unknown types, which go to the
+// handler set with HandleUnknown.
+//
+
+type EventHandlers struct {
+    mu       sync.Mutex
+    handlers map[string]func(DecodedEvent)
+    unknown  func(*UnknownEvent)
+}
+
+// Handle sets the handler for eventType, replacing any earlier one. A nil fn removes it.
+func (r *EventHandlers) Handle(eventType string, fn func(DecodedEvent)) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if fn == nil {
+        delete(r.handlers, eventType)
+        return
+    }
+    if r.handlers == nil {
+        r.handlers = make(map[string]func(DecodedEvent))
+    }
+    r.handlers[eventType] = fn
+}
+
+// HandleUnknown sets the handler for events of types this package does not know.
+func (r *EventHandlers) HandleUnknown(fn func(*UnknownEvent)) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.unknown = fn
+}
+
+// Dispatch decodes e and hands it to its handler.
+func (r *EventHandlers) Dispatch(e EventType) error {
+    d, err := e.Decode()
+    if err != nil {
+        return err
+    }
+
+    r.mu.Lock()
+    fn := r.handlers[e.Type]
+    unknown := r.unknown
+    r.mu.Unlock()
+
+    if u, ok := d.(*UnknownEvent); ok && fn == nil {
+        if unknown != nil {
+            unknown(u)
+        }
+        return nil
+    }
+    if fn != nil {
+        fn(d)
+    }
+    return nil
+}
+
+//
+// RunHandlers dispatches the events of src until it ends and returns
+// src.Err(). Events that fail to decode are logged and skipped.
+//
+
+func (c *Client) RunHandlers(src EventSource, r *EventHandlers) error {
+    for e := range src.Events() {
+        if err := r.Dispatch(e); err != nil {
+            c.log.Printf("%v", err)
+        }
+    }
+    return src.Err()
+}
+
+// Kind returns BitRateEventType.
+func (b *BitRateEvent) Kind() string {
+    return BitRateEventType
+}
@@ -0,0 +1,72 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestDecodeEvents(t *testing.T) {
+    doc := `<response command="get" category="event"><event-list>` +
+        `<event type="alarm-added-event" id="1435316297245" severity="major" description="Input loss"/>` +
+        `<event type="alarm-cleared-event" id="1435316297245" cleared-time="2015-06-26T16:38:02.513Z"/>` +
+        `<event type="heartbeat-event" id="1435265291353"/>` +
+        `<event type="fan-speed-event" id="1435265291360" rpm="3400"><fan id="2"/></event>` +
+        `</event-list></response>`
+    rsp := EventResponse{}
+    if err := xml.Unmarshal([]byte(doc), &rsp); err != nil {
+        t.Fatal(err)
+    }
+
+    var got []DecodedEvent
+    for i := range rsp.EventList.Events {
+        d, err := rsp.EventList.Events[i].Decode()
+        if err != nil {
+            t.Fatal(err)
+        }
+        got = append(got, d)
+    }
+
+    if a, ok := got[0].(*AlarmAdded); !ok || a.Severity != "major" || a.Description != "Input loss" {
+        t.Errorf("alarm-added decoded as %#v", got[0])
+    }
+    c, ok := got[1].(*AlarmCleared)
+    if !ok || !c.ClearedTime.Equal(time.Date(2015, 6, 26, 16, 38, 2, 513e6, time.UTC)) {
+        t.Errorf("alarm-cleared decoded as %#v", got[1])
+    }
+    if _, ok := got[2].(*Heartbeat); !ok {
+        t.Errorf("heartbeat decoded as %#v", got[2])
+    }
+    u, ok := got[3].(*UnknownEvent)
+    if !ok {
+        t.Fatalf("unknown type decoded as %#v", got[3])
+    }
+    if u.Attr("rpm") != "3400" || !strings.Contains(string(u.Raw), `rpm="3400"`) || !strings.Contains(string(u.Raw), `<fan id="2"/>`) {
+        t.Errorf("raw xml of unknown event not kept: %s", u.Raw)
+    }
+}
+
+func TestEventHandlersDispatch(t *testing.T) {
+    var seen []string
+    r := &EventHandlers{}
+    r.Handle(string(AlarmDeletedEvent), func(d DecodedEvent) {
+        seen = append(seen, "deleted "+d.(*AlarmDeleted).Id)
+    })
+    r.HandleUnknown(func(u *UnknownEvent) {
+        seen = append(seen, "unknown "+u.Type)
+    })
+
+    for _, e := range []EventType{
+        {Type: string(AlarmDeletedEvent), Id: "1435265291353"},
+        {Type: string(HeartbeatEvent), Id: "1435265291354"}, // no handler
+        {Type: "fan-speed-event", Id: "1435265291355"},
+    } {
+        if err := r.Dispatch(e); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if got := strings.Join(seen, ", "); got != "deleted 1435265291353, unknown fan-speed-event" {
+        t.Errorf("dispatched %s", got)
+    }
+}
@@ -0,0 +1,283 @@
+package me7k
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+)
+
+//
+// A Fleet collects from many devices at once. Each device has its own Client,
+// session and goroutine: it logs in, runs Device.Setup to subscribe, and
+// forwards the events of its session tagged with the device name. A device
+// that fails, or whose handling panics, is cleaned up and retried after a
+// growing delay without affecting the others. Health reports where every
+// device stands.
+//
+
+const (
+    DefaultFleetRetryDelay    = time.Second // wait before the first reconnect of a failed device
+    DefaultFleetMaxRetryDelay = time.Minute // longest wait between reconnects
+)
+
+//
+// Device is one member of a fleet. Name identifies it in events and health
+// reports and must be unique within the fleet.
+//
+
+type Device struct {
+    Name     string
+    Endpoint string
+    Options  Options
+
+    // Setup subscribes to events after every login; nil subscribes to nothing.
+    Setup func(ctx context.Context, c *Client) error
+}
+
+// FleetEvent is an event tagged with the device that sent it.
+type FleetEvent struct {
+    Device string
+    Event  EventType
+}
+
+type DeviceState int
+
+const (
+    DeviceConnecting DeviceState = iota // logging in and subscribing
+    DeviceUp                            // receiving events
+    DeviceDown                          // failed, waiting to retry
+    DeviceStopped                       // the fleet has stopped
+)
+
+func (s DeviceState) String() string {
+    switch s {
+    case DeviceConnecting:
+        return "connecting"
+    case DeviceUp:
+        return "up"
+    case DeviceDown:
+        return "down"
+    case DeviceStopped:
+        return "stopped"
+    }
+    return fmt.Sprintf("DeviceState(%d)", int(s))
+}
+
+// DeviceHealth is a snapshot of one device of a fleet.
+type DeviceHealth struct {
+    Device    string
+    Endpoint  string
+    State     DeviceState
+    Since     time.Time // when State was entered
+    SessionId string
+    SwVersion string
+    Events    uint64    // events forwarded since the fleet started
+    LastEvent time.Time // zero if none yet
+    Failures  int       // failures in a row, reset once events flow again
+    LastError error     // the most recent failure, kept after recovery; redacted, see redact.go
+}
+
+type Fleet struct {
+    members []*fleetMember
+    events  chan FleetEvent
+
+    retryDelay    time.Duration
+    maxRetryDelay time.Duration
+}
+
+type fleetMember struct {
+    device Device
+    client *Client
+
+    mu     sync.Mutex
+    health DeviceHealth
+}
+
+//
+// NewFleet creates the Clients of devices. Nothing is sent until Run.
+//
+
+func NewFleet(devices []Device) (*Fleet, error) {
+    f := &Fleet{events: make(chan FleetEvent, 256),
+        retryDelay: DefaultFleetRetryDelay, maxRetryDelay: DefaultFleetMaxRetryDelay}
+
+    names := make(map[string]bool)
+    for _, d := range devices {
+        if d.Name == "" {
+            return nil, fmt.Errorf("NewFleet - device %s has no name", d.Endpoint)
+        }
+        if names[d.Name] {
+            return nil, fmt.Errorf("NewFleet - device name %s used twice", d.Name)
+        }
+        names[d.Name] = true
+
+        c, err := NewClient(d.Endpoint, d.Options)
+        if err != nil {
+            return nil, fmt.Errorf("NewFleet - device %s: %w", d.Name, err)
+        }
+        m := &fleetMember{device: d, client: c}
+        m.health = DeviceHealth{Device: d.Name, Endpoint: d.Endpoint, State: DeviceConnecting, Since: time.Now()}
+        f.members = append(f.members, m)
+    }
+    return f, nil
+}
+
+// Events returns the channel the events of every device are delivered on. It is closed when Run returns.
+func (f *Fleet) Events() <-chan FleetEvent {
+    return f.events
+}
+
+// Client returns the Client of the device name, or nil if there is none.
+func (f *Fleet) Client(name string) *Client {
+    for _, m := range f.members {
+        if m.device.Name == name {
+            return m.client
+        }
+    }
+    return nil
+}
+
+// Health returns the state of every device, in the order they were given to NewFleet.
+func (f *Fleet) Health() []DeviceHealth {
+    h := make([]DeviceHealth, len(f.members))
+    for i, m := range f.members {
+        m.mu.Lock()
+        h[i] = m.health
+        m.mu.Unlock()
+    }
+    return h
+}
+
+//
+// Run collects from every device until ctx is done, then removes their
+// subscriptions and sessions and closes Events.
+//
+
+func (f *Fleet) Run(ctx context.Context) {
+    var wg sync.WaitGroup
+    for _, m := range f.members {
+        wg.Add(1)
+        go func(m *fleetMember) {
+            defer wg.Done()
+            f.runDevice(ctx, m)
+        }(m)
+    }
+    wg.Wait()
+    close(f.events)
+}
+
+func (f *Fleet) runDevice(ctx context.Context, m *fleetMember) {
+    delay := f.retryDelay
+    for {
+        delivered, err := f.session(ctx, m)
+        if ctx.Err() != nil {
+            m.setState(DeviceStopped, nil)
+            return
+        }
+        if delivered > 0 {
+            delay = f.retryDelay // it worked for a while, start over
+        }
+        m.setState(DeviceDown, err)
+        m.client.log.Printf("Fleet - device %s down, retrying in %v: %v", m.device.Name, delay, err)
+
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+            m.setState(DeviceStopped, nil)
+            return
+        }
+        if delay *= 2; delay > f.maxRetryDelay {
+            delay = f.maxRetryDelay
+        }
+    }
+}
+
+//
+// session runs one session of m until it fails or ctx is done, and always
+// cleans it up. It returns the number of events forwarded and why it ended.
+//
+
+func (f *Fleet) session(ctx context.Context, m *fleetMember) (delivered int, err error) {
+    c := m.client
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("panic: %v", r)
+        }
+        for _, r := range c.Shutdown(context.Background()) {
+            c.log.Printf("Fleet - device %s cleanup: %v", m.device.Name, r) // every step, as a failed one leaves a session behind
+        }
+    }()
+
+    m.setState(DeviceConnecting, nil)
+    if _, err := c.Login(ctx); err != nil {
+        return 0, err
+    }
+    if m.device.Setup != nil {
+        if err := m.device.Setup(ctx, c); err != nil {
+            return 0, fmt.Errorf("setup: %w", err)
+        }
+    }
+
+    var src EventSource
+    if c.opts.SessionType == SessionPush {
+        s, err := c.AddChannel(ctx)
+        if err != nil {
+            return 0, err
+        }
+        src = s
+    } else {
+        src = c.Poll(ctx, 0, 0)
+    }
+    defer src.Close()
+    m.setState(DeviceUp, nil)
+
+    for {
+        select {
+        case <-ctx.Done():
+            return delivered, ctx.Err()
+        case e, ok := <-src.Events():
+            if !ok {
+                if err := src.Err(); err != nil {
+                    return delivered, err
+                }
+                return delivered, fmt.Errorf("event source ended")
+            }
+            select {
+            case f.events <- FleetEvent{Device: m.device.Name, Event: e}:
+            case <-ctx.Done():
+                return delivered, ctx.Err()
+            }
+            delivered++
+            m.eventSeen()
+        }
+    }
+}
+
+func (m *fleetMember) setState(s DeviceState, err error) {
+    sess := m.client.Session()
+    d := m.client.Dialect()
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.health.State != s {
+        m.health.State = s
+        m.health.Since = time.Now()
+    }
+    m.health.SessionId = sess.SessionId
+    if d.SwVersion != "" {
+        m.health.SwVersion = d.SwVersion
+    }
+    if err != nil {
+        m.health.Failures++
+        m.health.LastError = m.client.redactError(err)
+    }
+}
+
+func (m *fleetMember) eventSeen() {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.health.Events++
+    m.health.LastEvent = time.Now()
+    m.health.Failures = 0
+}
@@ -0,0 +1,97 @@
+package me7k
+
+import (
+    "bytes"
+    "context"
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestFleetIsolatesFailingDevice(t *testing.T) {
+    good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var env struct {
+            Envelope
+        }
+        xml.Unmarshal(body, &env)
+        switch {
+        case env.Category == "login" && env.Command == "add":
+            fmt.Fprint(w, `<response command="add" category="login" sw-version="me7k.2.2.0"><session sid="1" type="pull"/></response>`)
+        case env.Category == "event":
+            fmt.Fprint(w, `<response command="get" category="event"><event-list><event type="heartbeat-event" id="1435265291353"/></event-list></response>`)
+        default:
+            fmt.Fprintf(w, `<response command="%s" category="%s"><reason error-code="OK">succeeded.</reason></response>`, env.Command, env.Category)
+        }
+    }))
+    defer good.Close()
+    bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+    }))
+    defer bad.Close()
+
+    var logged bytes.Buffer
+    setups := 0
+    f, err := NewFleet([]Device{
+        {Name: "horsham", Endpoint: good.URL, Options: Options{DisableKeepAlive: true, Logger: log.New(&logged, "", 0)}, Setup: func(ctx context.Context, c *Client) error {
+            setups++
+            return c.SubscribeDevice(context.Background(), "ME-7000-2", HeartbeatEvent)
+        }},
+        {Name: "san-diego", Endpoint: bad.URL, Options: Options{DisableKeepAlive: true}},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.retryDelay = 10 * time.Millisecond
+    f.maxRetryDelay = 20 * time.Millisecond
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        f.Run(ctx)
+        close(done)
+    }()
+
+    e := <-f.Events()
+    if e.Device != "horsham" || e.Event.Type != string(HeartbeatEvent) {
+        t.Errorf("got %+v", e)
+    }
+
+    deadline := time.Now().Add(2 * time.Second)
+    for f.Health()[1].Failures < 2 && time.Now().Before(deadline) {
+        time.Sleep(5 * time.Millisecond)
+    }
+    h := f.Health()
+    if h[0].State != DeviceUp || h[0].SessionId != "1" || h[0].SwVersion != "me7k.2.2.0" || h[0].Events == 0 {
+        t.Errorf("horsham health %+v", h[0])
+    }
+    if h[1].State == DeviceUp || h[1].Failures < 2 || h[1].LastError == nil {
+        t.Errorf("san-diego health %+v", h[1])
+    }
+
+    cancel()
+    for range f.Events() {
+    }
+    <-done
+    for _, h := range f.Health() {
+        if h.State != DeviceStopped || h.SessionId != "" {
+            t.Errorf("after Run %+v", h)
+        }
+    }
+    if !strings.Contains(logged.String(), "Fleet - device horsham cleanup: remove login session") {
+        t.Errorf("successful cleanup not logged:\n%s", logged.String())
+    }
+    if setups != 1 {
+        t.Errorf("setup ran %d times", setups)
+    }
+
+    if _, err := NewFleet([]Device{{Name: "a", Endpoint: good.URL}, {Name: "a", Endpoint: bad.URL}}); err == nil {
+        t.Error("duplicate device names accepted")
+    }
+}
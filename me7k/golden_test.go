@@ -0,0 +1,313 @@
+package me7k
+
+import (
+    "bytes"
+    "encoding/xml"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+//
+// The conformance suite checks the messages against testdata, a corpus made
+// from the documented samples in the source comments with the typos of the
+// protocol document fixed. Requests must marshal to exactly the bytes of
+// their file. Responses must decode without losing anything: encoding the
+// decoded value again has to give back every element, attribute and text of
+// the file, but for zero counts, which are left out. Run with -update to
+// rewrite the request files after an intended change.
+//
+// testdata/assumed holds the formats no sample documents, those marked
+// assumed in the source comments. They are checked the same way, but only
+// pin down what this package sends and expects, not what a device does.
+//
+
+var update = flag.Bool("update", false, "rewrite the golden request files in testdata")
+
+func envelope(id, origin, command, category, time, version, sid string) Envelope {
+    return Envelope{Id: id, Origin: origin, Destination: "device", Command: command, Category: category,
+        Time: time, Version: version, Platform: "neo", SessionId: sid}
+}
+
+type goldenRequest struct {
+    file string
+    v    interface{}
+}
+
+type goldenResponse struct {
+    file    string
+    rsp     func() interface{}
+    wantErr error
+}
+
+func TestGoldenRequests(t *testing.T) {
+    program := NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014").OutputProgram("1")
+    var deviceEvents []DeviceEventItem
+    for _, e := range AllDeviceEvents {
+        deviceEvents = append(deviceEvents, DeviceEventItem{Type: e})
+    }
+
+    checkRequests(t, filepath.Join("testdata", "requests"), []goldenRequest{
+        {"add-login.xml", &LoginRequest{
+            Envelope: envelope("G1000", "gui", "add", "login", "2015-03-09T17:38:09.783-06:00", "2.3", ""),
+            User:     User{Name: "Admin", Password: "", Type: "push"},
+        }},
+        {"remove-login.xml", &RemoveLoginRequest{
+            Envelope: envelope("G1037", "gui", "remove", "login", "2015-03-09T17:38:29.783-06:00", "2.3", "949098745790"),
+        }},
+        {"add-subscription-bitrate.xml", &BitRateRequest{
+            Envelope: envelope("G1201", "gui", "add", "subscription", "2016-02-09T11:30:20.508-06:00", "2.3", "9223370581815793597"),
+            Path:     program,
+            Event: Event{EventBitRate: EventBitRate{Type: BitRateEventType, GetStreams: "true", GetStdDev: "true",
+                GetInstBr: "true", GetAvgBr: "true", GetVideoInfo: "true", GetAudioInfo: "true"}},
+        }},
+        {"remove-subscription-bitrate.xml", &BitRateRequest{
+            Envelope: envelope("G1204", "gui", "remove", "subscription", "2016-02-09T11:32:20.177-06:00", "2.3", "9223370581815793597"),
+            Path:     program,
+            Event:    Event{EventBitRate: EventBitRate{Type: BitRateEventType}},
+        }},
+        {"add-subscription-device.xml", &DeviceRequest{
+            Envelope:    envelope("G1040", "gui", "add", "subscription", "2016-02-08T18:16:29.271-06:00", "2.3", "1454976988853"),
+            Path:        NewPath("ME-7000-2"),
+            DeviceEvent: DeviceEvent{Events: deviceEvents},
+        }},
+        {"get-event.xml", &EventRequest{
+            Envelope: envelope("G1111", "gui", "get", "event", "2015-06-26T16:37:59.491Z", "1.0", "1435336628026"),
+        }},
+        {"add-channel.xml", &EventRequest{
+            Envelope: envelope("G1168", "gui", "add", "channel", "2015-06-25T15:11:44.595Z", "2.3", "9223370601591671158"),
+        }},
+    })
+}
+
+func TestAssumedRequests(t *testing.T) {
+    checkRequests(t, filepath.Join("testdata", "assumed", "requests"), []goldenRequest{
+        {"get-login.xml", &KeepAliveRequest{
+            Envelope: envelope("C1042", "transcoder-collector", "get", "login", "2017-09-19T15:20:44.879-07:00", "2.1", "949098745790"),
+        }},
+        {"get-sessions.xml", &SessionsRequest{
+            Envelope: envelope("C1003", "transcoder-collector", "get", "sessions", "2017-08-30T16:24:54.900-07:00", "2.1", ""),
+            User:     User{Name: "Admin", Password: ""},
+        }},
+        {"get-alarm.xml", &AlarmsRequest{
+            Envelope: envelope("C1004", "transcoder-collector", "get", "alarm", "2017-08-30T16:24:54.900-07:00", "2.1", "949098745790"),
+            Path:     NewPath("ME-7000-2"),
+        }},
+    })
+}
+
+// checkRequests marshals every request of tests and compares it with its file in dir.
+func checkRequests(t *testing.T, dir string, tests []goldenRequest) {
+    for _, tt := range tests {
+        file := filepath.Join(dir, tt.file)
+        got, err := Marshal(tt.v)
+        if err != nil {
+            t.Errorf("%s: Marshal: %v", tt.file, err)
+            continue
+        }
+        got = append(got, '\n')
+
+        if *update {
+            if err := ioutil.WriteFile(file, got, 0644); err != nil {
+                t.Fatal(err)
+            }
+            continue
+        }
+        want, err := ioutil.ReadFile(file)
+        if err != nil {
+            t.Errorf("%s: %v", tt.file, err)
+            continue
+        }
+        if !bytes.Equal(got, want) {
+            t.Errorf("%s:\n got %s\nwant %s", tt.file, got, want)
+        }
+    }
+}
+
+func TestGoldenResponses(t *testing.T) {
+    checkResponses(t, filepath.Join("testdata", "responses"), []goldenResponse{
+        {"add-login.xml", func() interface{} { return &LoginResponse{} }, nil},
+        {"add-login-session-limit.xml", func() interface{} { return &LoginResponse{} }, ErrSessionLimit},
+        {"remove-login.xml", func() interface{} { return &RemoveLoginResponse{} }, nil},
+        {"add-subscription.xml", func() interface{} { return &Response{} }, nil},
+        {"remove-subscription.xml", func() interface{} { return &Response{} }, nil},
+        {"get-event.xml", func() interface{} { return &EventResponse{} }, nil},
+        {"get-event-bitrate.xml", func() interface{} { return &EventResponse{} }, nil},
+        {"add-channel.xml", func() interface{} { return &EventResponse{} }, nil},
+    })
+}
+
+func TestAssumedResponses(t *testing.T) {
+    checkResponses(t, filepath.Join("testdata", "assumed", "responses"), []goldenResponse{
+        {"get-sessions.xml", func() interface{} { return &SessionsResponse{} }, nil},
+        {"get-alarm.xml", func() interface{} { return &AlarmsResponse{} }, nil},
+    })
+}
+
+// checkResponses decodes every response file in dir, which must all be in tests, and checks nothing was lost.
+func checkResponses(t *testing.T, dir string, tests []goldenResponse) {
+    files, _ := filepath.Glob(filepath.Join(dir, "*.xml"))
+    if len(files) != len(tests) {
+        t.Errorf("%d response files in %s, %d tested", len(files), dir, len(tests))
+    }
+
+    for _, tt := range tests {
+        data, err := ioutil.ReadFile(filepath.Join(dir, tt.file))
+        if err != nil {
+            t.Errorf("%s: %v", tt.file, err)
+            continue
+        }
+
+        err = decodeResponse(tt.file, data, tt.rsp())
+        if tt.wantErr != nil || err != nil {
+            if !errors.Is(err, tt.wantErr) {
+                t.Errorf("%s: error %v, want %v", tt.file, err, tt.wantErr)
+            }
+        }
+
+        rsp := tt.rsp()
+        if err := xml.Unmarshal(data, rsp); err != nil {
+            t.Errorf("%s: Unmarshal: %v", tt.file, err)
+            continue
+        }
+        again, err := Marshal(rsp)
+        if err != nil {
+            t.Errorf("%s: Marshal: %v", tt.file, err)
+            continue
+        }
+        if err := sameDocument(data, again); err != nil {
+            t.Errorf("%s: not decoded losslessly: %v\nre-encoded: %s", tt.file, err, again)
+        }
+
+        if er, ok := rsp.(*EventResponse); ok {
+            for _, e := range er.EventList.Events {
+                if _, err := e.Decode(); err != nil {
+                    t.Errorf("%s: event %s: %v", tt.file, e.Id, err)
+                }
+            }
+        }
+    }
+}
+
+//
+// node is an element of a document, reduced to what the protocol gives a
+// meaning to: names, attribute values and text without the surrounding blanks.
+//
+
+type node struct {
+    name     string
+    attrs    map[string]string
+    text     string
+    children []*node
+}
+
+func parseDocument(data []byte) (*node, error) {
+    d := xml.NewDecoder(bytes.NewReader(data))
+    var stack []*node
+    var root *node
+    for {
+        tok, err := d.Token()
+        if err == io.EOF {
+            return root, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+        switch t := tok.(type) {
+        case xml.StartElement:
+            n := &node{name: t.Name.Local, attrs: make(map[string]string)}
+            for _, a := range t.Attr {
+                n.attrs[a.Name.Local] = a.Value
+            }
+            if len(stack) > 0 {
+                parent := stack[len(stack)-1]
+                parent.children = append(parent.children, n)
+            } else {
+                root = n
+            }
+            stack = append(stack, n)
+        case xml.EndElement:
+            stack = stack[:len(stack)-1]
+        case xml.CharData:
+            if len(stack) > 0 {
+                stack[len(stack)-1].text += strings.TrimSpace(string(t))
+            }
+        }
+    }
+}
+
+// empty reports whether n carries nothing, like the <reason error-code=""/> encoded for an absent reason.
+func (n *node) empty() bool {
+    for _, v := range n.attrs {
+        if v != "" {
+            return false
+        }
+    }
+    return n.text == "" && len(n.children) == 0
+}
+
+//
+// sameDocument checks that encoded holds everything original does. Encoding
+// may add attributes without a value and empty elements for fields the
+// original does not have, nothing else.
+//
+
+func sameDocument(original, encoded []byte) error {
+    o, err := parseDocument(original)
+    if err != nil {
+        return err
+    }
+    e, err := parseDocument(encoded)
+    if err != nil {
+        return err
+    }
+    return covers(o, e, "/"+o.name)
+}
+
+func covers(o, e *node, at string) error {
+    if o.name != e.name {
+        return fmt.Errorf("%s: element %s became %s", at, o.name, e.name)
+    }
+    for k, v := range o.attrs {
+        got, ok := e.attrs[k]
+        if !ok && v == "0" {
+            continue // a zero count left out by omitempty decodes to the same value
+        }
+        if got != v {
+            return fmt.Errorf("%s: attribute %s=%q became %q", at, k, v, got)
+        }
+    }
+    for k, v := range e.attrs {
+        if _, ok := o.attrs[k]; !ok && v != "" {
+            return fmt.Errorf("%s: attribute %s=%q added", at, k, v)
+        }
+    }
+    if o.text != e.text {
+        return fmt.Errorf("%s: text %q became %q", at, o.text, e.text)
+    }
+
+    i := 0
+    for _, oc := range o.children {
+        for i < len(e.children) && e.children[i].name != oc.name && e.children[i].empty() {
+            i++
+        }
+        if i == len(e.children) {
+            return fmt.Errorf("%s: element %s lost", at, oc.name)
+        }
+        if err := covers(oc, e.children[i], at+"/"+oc.name); err != nil {
+            return err
+        }
+        i++
+    }
+    for ; i < len(e.children); i++ {
+        if !e.children[i].empty() {
+            return fmt.Errorf("%s: element %s added", at, e.children[i].name)
+        }
+    }
+    return nil
+}
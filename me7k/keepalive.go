@@ -0,0 +1,138 @@
+package me7k
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strconv"
+    "time"
+)
+
+//
+// The device drops a session that sends nothing for activity-timeout
+// milliseconds (300000 by default). While a session is logged in, the
+// keepalive watches the time of the last request and sends a KeepAliveRequest
+// once half of the timeout has passed without one. If the session is gone
+// anyway, because the device refused the sid or nothing got through before
+// the timeout, the session is replaced as described in session.go, or if that
+// is disabled or fails, Options.OnSessionLost is called and the keepalive stops.
+//
+
+// ErrSessionExpired is reported when no request reached the device within the activity timeout.
+var ErrSessionExpired = errors.New("session activity timeout expired")
+
+// Timeout returns the activity timeout of the session, or 0 if the device did not send one.
+func (s Session) Timeout() time.Duration {
+    ms, err := strconv.ParseInt(s.ActivityTimeout, 10, 64)
+    if err != nil || ms <= 0 {
+        return 0
+    }
+    return time.Duration(ms) * time.Millisecond
+}
+
+type keepAlive struct {
+    stop chan struct{}
+    done chan struct{}
+}
+
+func (c *Client) startKeepAlive(s Session) {
+    c.stopKeepAlive()
+
+    timeout := s.Timeout()
+    if timeout == 0 {
+        return
+    }
+
+    k := &keepAlive{stop: make(chan struct{}), done: make(chan struct{})}
+    c.mu.Lock()
+    c.keepAlive = k
+    c.mu.Unlock()
+
+    go c.runKeepAlive(k, s.SessionId, timeout)
+}
+
+func (c *Client) stopKeepAlive() {
+    c.mu.Lock()
+    k := c.keepAlive
+    c.keepAlive = nil
+    c.mu.Unlock()
+
+    if k != nil {
+        close(k.stop)
+        <-k.done
+    }
+}
+
+// active records that the device accepted a request, which resets its activity timer.
+func (c *Client) active() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.lastActivity = time.Now()
+}
+
+func (c *Client) idleSince() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.lastActivity
+}
+
+func (c *Client) runKeepAlive(k *keepAlive, sid string, timeout time.Duration) {
+    defer close(k.done)
+
+    retry := timeout / 10 // after a failed keepalive
+    timer := time.NewTimer(timeout / 2)
+    defer timer.Stop()
+
+    for {
+        select {
+        case <-timer.C:
+        case <-k.stop:
+            return
+        }
+
+        last := c.idleSince()
+        if due := last.Add(timeout / 2); time.Now().Before(due) {
+            timer.Reset(time.Until(due)) // something else kept the session busy
+            continue
+        }
+
+        err := c.callOnce(context.Background(), "KeepAlive", &KeepAliveRequest{Envelope: c.envelope("get", "login")}, nil)
+        if err == nil {
+            timer.Reset(timeout / 2)
+            continue
+        }
+        c.log.Printf("KeepAlive - %v", err)
+
+        var lost error
+        if errors.Is(err, ErrInvalidSession) {
+            lost = err
+        } else if time.Since(last) >= timeout {
+            lost = fmt.Errorf("%w: %v", ErrSessionExpired, err)
+        }
+        if lost == nil {
+            timer.Reset(retry)
+            continue
+        }
+
+        // only report if this is still the current session
+        c.mu.Lock()
+        current := c.keepAlive == k
+        if current {
+            c.keepAlive = nil
+        }
+        c.mu.Unlock()
+
+        if !current {
+            return
+        }
+        if !c.opts.DisableRelogin {
+            if err := c.relogin(context.Background(), sid); err == nil || c.sessionId() != sid {
+                return // the new session has its own keepalive
+            }
+        }
+        if c.opts.OnSessionLost != nil {
+            c.opts.OnSessionLost(sid, c.redactError(lost))
+        }
+        return
+    }
+}
@@ -0,0 +1,117 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// keepAliveServer logs in with a 200ms activity timeout and answers keepalives with reply, sending their times on the channel.
+func keepAliveServer(t *testing.T, reply string) (*httptest.Server, <-chan time.Time) {
+    keepalives := make(chan time.Time, 100)
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var env struct {
+            Envelope
+        }
+        if err := xml.Unmarshal(body, &env); err != nil {
+            t.Errorf("bad request %s", body)
+        }
+        switch env.Command + " " + env.Category {
+        case "add login":
+            fmt.Fprint(w, `<response command="add" category="login"><session sid="949098745790" type="pull" activity-timeout="200"/></response>`)
+        case "get login":
+            keepalives <- time.Now()
+            fmt.Fprint(w, reply)
+        default:
+            t.Errorf("unexpected request %s", body)
+        }
+    }))
+    return srv, keepalives
+}
+
+func TestKeepAliveKeepsIdleSession(t *testing.T) {
+    srv, keepalives := keepAliveServer(t, `<response command="get" category="login"><reason error-code="OK">succeeded.</reason></response>`)
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{OnSessionLost: func(sid string, err error) {
+        t.Errorf("session %s lost: %v", sid, err)
+    }})
+    start := time.Now()
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    defer c.stopKeepAlive()
+
+    for i := 1; i <= 3; i++ {
+        select {
+        case at := <-keepalives:
+            // one every half timeout, so never before i*100ms and well before the session would expire
+            if since := at.Sub(start); since < time.Duration(i)*90*time.Millisecond {
+                t.Errorf("keepalive %d after %v", i, since)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("keepalive %d not sent", i)
+        }
+    }
+}
+
+func TestKeepAliveReportsLostSession(t *testing.T) {
+    srv, _ := keepAliveServer(t, `<response command="get" category="login" status="error">`+
+        `<reason error-code="Unknown_Error"><![CDATA[Invalid session id 949098745790.]]></reason></response>`)
+    defer srv.Close()
+
+    lost := make(chan error, 1)
+    c, _ := NewClient(srv.URL, Options{DisableRelogin: true, OnSessionLost: func(sid string, err error) {
+        if sid != "949098745790" {
+            t.Errorf("lost sid %s", sid)
+        }
+        lost <- err
+    }})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+
+    select {
+    case err := <-lost:
+        if !errors.Is(err, ErrInvalidSession) {
+            t.Errorf("lost with %v, want ErrInvalidSession", err)
+        }
+        if strings.Contains(err.Error(), "949098745790") {
+            t.Errorf("lost with %v, the sid is not redacted", err)
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatal("lost session not reported")
+    }
+}
+
+func TestKeepAliveRefusedExpires(t *testing.T) {
+    srv, _ := keepAliveServer(t, `<response command="get" category="login" status="error">`+
+        `<reason error-code="Unknown_Error"><![CDATA[Invalid path /login.]]></reason></response>`)
+    defer srv.Close()
+
+    lost := make(chan error, 1)
+    c, _ := NewClient(srv.URL, Options{DisableRelogin: true, OnSessionLost: func(sid string, err error) {
+        lost <- err
+    }})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+
+    select {
+    case err := <-lost:
+        if !errors.Is(err, ErrSessionExpired) {
+            t.Errorf("lost with %v, want ErrSessionExpired", err)
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatal("refused keepalives kept the session alive")
+    }
+}
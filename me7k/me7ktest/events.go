@@ -0,0 +1,258 @@
+package me7ktest
+
+import (
+    "encoding/xml"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/beacham/go_client/me7k"
+)
+
+//
+// Events are queued for every session subscribed to them and handed out by
+// get event or streamed on the session's channel. Event ids are creation
+// times in milliseconds like the device's, made unique by counting on from
+// the last id when several events are created in the same millisecond.
+//
+
+// nextEventId returns a new event id. The caller holds s.mu.
+func (s *Server) nextEventId() string {
+    id := time.Now().UnixNano() / int64(time.Millisecond)
+    if id <= s.lastEvent {
+        id = s.lastEvent + 1
+    }
+    s.lastEvent = id
+    return strconv.FormatInt(id, 10)
+}
+
+// enqueue queues e for ss and wakes its channel. The caller holds s.mu.
+func (ss *session) enqueue(e me7k.EventType) {
+    if len(ss.queue) >= maxQueuedEvents {
+        ss.queue = ss.queue[1:]
+    }
+    ss.queue = append(ss.queue, e)
+    select {
+    case ss.wake <- struct{}{}:
+    default:
+    }
+}
+
+//
+// Publish queues the device-wide event e for every session subscribed to its
+// type and returns the number of sessions. An empty id or time is filled in.
+//
+
+func (s *Server) Publish(e me7k.EventType) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.publish(e)
+}
+
+func (s *Server) publish(e me7k.EventType) int {
+    if e.Id == "" {
+        e.Id = s.nextEventId()
+    }
+    if e.Time == "" {
+        e.Time = me7k.FormatTime(time.Now().UTC())
+    }
+    n := 0
+    for _, ss := range s.sessions {
+        if ss.device[me7k.DeviceEventType(e.Type)] {
+            ss.enqueue(e)
+            n++
+        }
+    }
+    return n
+}
+
+//
+// PublishBitRates queues a bit-rate-event for every bit rate subscription
+// and returns the number of events. The rates wander around a base rate
+// chosen for each target, like those of a constant bit rate encoder.
+//
+
+func (s *Server) PublishBitRates() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var sids []string
+    for sid := range s.sessions {
+        sids = append(sids, sid)
+    }
+    sort.Strings(sids) // the same seed gives the same rates
+
+    n := 0
+    for _, sid := range sids {
+        ss := s.sessions[sid]
+        paths := make([]me7k.Path, 0, len(ss.bitRates))
+        for p := range ss.bitRates {
+            paths = append(paths, p)
+        }
+        sort.Slice(paths, func(i, j int) bool { return paths[i].String() < paths[j].String() })
+
+        for _, p := range paths {
+            ss.enqueue(s.bitRateEvent(p))
+            n++
+        }
+    }
+    return n
+}
+
+// bitRateEvent returns an event with the rates of target. The caller holds s.mu.
+func (s *Server) bitRateEvent(target me7k.Path) me7k.EventType {
+    base, ok := s.rates[target]
+    if !ok {
+        base = 2000000 + s.rand.Int63n(6000000) // a video service of 2 to 8 Mb/s
+        s.rates[target] = base
+    }
+    jitter := func(rate int64, fraction float64) int64 {
+        return rate + int64(float64(rate)*fraction*(2*s.rand.Float64()-1))
+    }
+
+    program := me7k.ProgramBitRate{Id: "1"}
+    if target.Level() == me7k.LevelOutputProgram {
+        program.Id = target.Id(me7k.LevelOutputProgram)
+    }
+    for i, rate := range []int64{base, 192000, 96000} { // video and two audio streams
+        stream := me7k.StreamBitRate{
+            Id:          strconv.Itoa(32 + i),
+            AvgBitRate:  jitter(rate, 0.01),
+            InstBitRate: jitter(rate, 0.05),
+            StdDev:      float64(jitter(rate/50, 0.2)),
+        }
+        program.Streams = append(program.Streams, stream)
+        program.AvgBitRate += stream.AvgBitRate
+        program.InstBitRate += stream.InstBitRate
+    }
+
+    mux := me7k.MuxBitRate{Id: "0000", Programs: []me7k.ProgramBitRate{program}}
+    if target.Level() >= me7k.LevelGigeOutputMux {
+        mux.Id = target.Id(me7k.LevelGigeOutputMux)
+    }
+    pids := me7k.PidBitRate{Id: "65536", AvgBitRate: jitter(15000, 0.01), InstBitRate: jitter(15000, 0.1)}
+    mux.PassedPids = []me7k.PidBitRate{pids}
+    mux.Overhead = program.InstBitRate / 30
+    mux.AvgBitRate = program.AvgBitRate + pids.AvgBitRate + mux.Overhead
+    mux.InstBitRate = program.InstBitRate + pids.InstBitRate + mux.Overhead
+
+    path, _ := me7k.Marshal(target)
+    body, _ := me7k.Marshal(&mux)
+    return me7k.EventType{
+        Type:  me7k.BitRateEventType,
+        Id:    s.nextEventId(),
+        Time:  me7k.FormatTime(time.Now().UTC()),
+        Inner: append(path, body...),
+    }
+}
+
+//
+// RaiseAlarm adds an active alarm, publishes its alarm-added-event and
+// returns its id.
+//
+
+func (s *Server) RaiseAlarm(severity, description string) string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.raiseAlarm(severity, description)
+}
+
+func (s *Server) raiseAlarm(severity, description string) string {
+    a := &me7k.AlarmEntry{Id: s.nextEventId(), Severity: severity, Description: description, Time: me7k.FormatTime(time.Now().UTC())}
+    s.alarms[a.Id] = a
+    s.publish(me7k.EventType{Type: string(me7k.AlarmAddedEvent), Id: a.Id, Attrs: []xml.Attr{
+        {Name: xml.Name{Local: "severity"}, Value: severity},
+        {Name: xml.Name{Local: "description"}, Value: description},
+    }})
+    return a.Id
+}
+
+// ClearAlarm clears the active alarm id and publishes its alarm-cleared-event. It reports whether there was one.
+func (s *Server) ClearAlarm(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.clearAlarm(id)
+}
+
+func (s *Server) clearAlarm(id string) bool {
+    a, ok := s.alarms[id]
+    if !ok || a.ClearedTime != "" {
+        return false
+    }
+    a.ClearedTime = me7k.FormatTime(time.Now().UTC())
+    s.publish(me7k.EventType{Type: string(me7k.AlarmClearedEvent), Id: id, Attrs: []xml.Attr{
+        {Name: xml.Name{Local: "cleared-time"}, Value: a.ClearedTime},
+    }})
+    return true
+}
+
+// DeleteAlarm removes the alarm id and publishes its alarm-deleted-event. It reports whether there was one.
+func (s *Server) DeleteAlarm(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.deleteAlarm(id)
+}
+
+func (s *Server) deleteAlarm(id string) bool {
+    if _, ok := s.alarms[id]; !ok {
+        return false
+    }
+    delete(s.alarms, id)
+    s.publish(me7k.EventType{Type: string(me7k.AlarmDeletedEvent), Id: id})
+    return true
+}
+
+var sampleAlarms = []struct{ severity, description string }{
+    {"critical", "Input loss"},
+    {"major", "Video PID missing"},
+    {"minor", "Fan speed"},
+    {"warning", "Bit rate above limit"},
+}
+
+//
+// generate publishes events every EventInterval until Close: bit rates on
+// every tick, a heartbeat every tenth, and now and then an alarm that is
+// raised, cleared a few ticks later and then deleted.
+//
+
+func (s *Server) generate() {
+    defer s.wg.Done()
+
+    ticker := time.NewTicker(s.opts.EventInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+        case <-s.done:
+            return
+        }
+        s.PublishBitRates()
+
+        s.mu.Lock()
+        s.ticks++
+        if s.ticks%10 == 0 {
+            s.publish(me7k.EventType{Type: string(me7k.HeartbeatEvent)})
+        }
+
+        var ids []string
+        for id := range s.alarms {
+            ids = append(ids, id)
+        }
+        sort.Strings(ids)
+        for _, id := range ids {
+            if s.rand.Intn(5) > 0 {
+                continue
+            }
+            if s.alarms[id].ClearedTime == "" {
+                s.clearAlarm(id)
+            } else {
+                s.deleteAlarm(id)
+            }
+        }
+        if s.rand.Intn(10) == 0 {
+            a := sampleAlarms[s.rand.Intn(len(sampleAlarms))]
+            s.raiseAlarm(a.severity, a.description)
+        }
+        s.mu.Unlock()
+    }
+}
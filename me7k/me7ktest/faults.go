@@ -0,0 +1,196 @@
+package me7ktest
+
+import (
+    "bytes"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+//
+// A Server can be told to misbehave in the ways a real device does. Each
+// FaultRule picks the requests it applies to by command and category and
+// by counting them, so a test knows exactly which request fails:
+//
+//   srv.Inject(me7ktest.FaultRule{Fault: me7ktest.FaultHTTP500, Request: "get event", Skip: 2, Count: 1})
+//
+// fails the third get event, and only that one. The rules are checked in
+// the order they were injected and the first that applies wins.
+//
+
+type Fault int
+
+const (
+    FaultSessionLimit  Fault = iota + 1 // answer with the "Number of sessions exceeded" error
+    FaultExpireSession                  // the session expires before the request, or AfterEvents into its channel
+    FaultTruncated                      // the response ends half way, the connection is closed
+    FaultMalformed                      // the response is not well-formed XML
+    FaultSlow                           // the response is delayed by Delay
+    FaultHTTP500                        // the web server fails with an HTML error page
+    FaultDropChannel                    // the channel connection drops in the middle of an event, AfterEvents into it
+)
+
+var faultNames = map[Fault]string{
+    FaultSessionLimit:  "session-limit",
+    FaultExpireSession: "expire-session",
+    FaultTruncated:     "truncated",
+    FaultMalformed:     "malformed",
+    FaultSlow:          "slow",
+    FaultHTTP500:       "http-500",
+    FaultDropChannel:   "drop-channel",
+}
+
+func (f Fault) String() string {
+    if name, ok := faultNames[f]; ok {
+        return name
+    }
+    return "Fault(" + strconv.Itoa(int(f)) + ")"
+}
+
+type FaultRule struct {
+    Fault       Fault
+    Request     string        // command and category, e.g. "add login"; "" for every request
+    Skip        int           // let this many matching requests through first
+    Count       int           // then fail this many, 0 for all that follow
+    Delay       time.Duration // how long FaultSlow waits
+    AfterEvents int           // events a channel delivers before FaultExpireSession or FaultDropChannel hits it
+}
+
+type faultState struct {
+    FaultRule
+    seen int // matching requests so far
+    hits int // requests the fault was applied to
+}
+
+// Inject adds a fault rule. It applies to requests received from now on.
+func (s *Server) Inject(rule FaultRule) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.faults = append(s.faults, &faultState{FaultRule: rule})
+}
+
+// ClearFaults removes every fault rule, so the Server behaves again.
+func (s *Server) ClearFaults() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.faults = nil
+}
+
+//
+// FaultHits returns how many requests a fault was applied to, summed over the
+// rules for it.
+//
+
+func (s *Server) FaultHits(f Fault) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    n := 0
+    for _, st := range s.faults {
+        if st.Fault == f {
+            n += st.hits
+        }
+    }
+    return n
+}
+
+// ExpireSession drops the session sid as if its activity timeout had passed. It reports whether there was one.
+func (s *Server) ExpireSession(sid string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, ok := s.sessions[sid]
+    s.expireSession(sid)
+    return ok
+}
+
+//
+// expireSession removes the session sid. An open channel of the session is
+// ended with an invalid session error. The caller holds s.mu.
+//
+
+func (s *Server) expireSession(sid string) {
+    if ss, ok := s.sessions[sid]; ok {
+        ss.expired = true
+        s.remove(sid)
+    }
+}
+
+// fault returns the rule that applies to req, counting req against every rule it matches. The caller holds s.mu.
+func (s *Server) fault(req *request) *FaultRule {
+    var hit *FaultRule
+    for _, st := range s.faults {
+        if st.Request != "" && st.Request != req.Command+" "+req.Category {
+            continue
+        }
+        st.seen++
+        if hit != nil || st.seen <= st.Skip || (st.Count > 0 && st.hits >= st.Count) {
+            continue
+        }
+        st.hits++
+        hit = &st.FaultRule
+    }
+    return hit
+}
+
+//
+// applyFault misbehaves as f says before req is served, and reports whether
+// the response has been written already. Channel faults are left to the
+// channel, see addChannel.
+//
+
+func (s *Server) applyFault(w http.ResponseWriter, r *http.Request, req *request, f *FaultRule) bool {
+    switch f.Fault {
+    case FaultSessionLimit:
+        s.write(w, s.errorResponse(req, "Number of sessions exceeded the maximum of %d.", s.opts.MaxSessions))
+        return true
+    case FaultExpireSession:
+        if req.Category != "channel" {
+            s.mu.Lock()
+            s.expireSession(req.SessionId)
+            s.mu.Unlock()
+        }
+    case FaultSlow:
+        select {
+        case <-time.After(f.Delay):
+        case <-r.Context().Done():
+        case <-s.done:
+        }
+    case FaultHTTP500:
+        w.Header().Set("Content-Type", "text/html")
+        w.WriteHeader(http.StatusInternalServerError)
+        fmt.Fprint(w, "<html><head><title>500 Internal Server Error</title></head>"+
+            "<body><h1>Internal Server Error</h1><p>The server encountered an internal error.</p></body></html>")
+        return true
+    }
+    return false
+}
+
+//
+// corrupt spoils the response out as f says: FaultTruncated sends half of it
+// and closes the connection, FaultMalformed drops the closing quote of the
+// first attribute.
+//
+
+func corrupt(w http.ResponseWriter, out []byte, f *FaultRule) {
+    w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+    switch f.Fault {
+    case FaultTruncated:
+        w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+        w.Write(out[:len(out)/2])
+        w.(http.Flusher).Flush()
+        panic(http.ErrAbortHandler) // closes the connection without finishing the response
+    case FaultMalformed:
+        w.Write(bytes.Replace(out, []byte(`" `), []byte(` `), 1))
+    }
+}
+
+//
+// dropChannel writes the first half of the event out and closes the
+// connection of the add channel response.
+//
+
+func dropChannel(w http.ResponseWriter, out []byte) {
+    w.Write(out[:len(out)/2])
+    w.(http.Flusher).Flush()
+    panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,173 @@
+package me7ktest
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/beacham/go_client/me7k"
+)
+
+var quickRetry = &me7k.RetryPolicy{MaxAttempts: 3, InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func pullClient(t *testing.T, srv *Server, opts me7k.Options) *me7k.Client {
+    opts.User = "Admin"
+    c, err := me7k.NewClient(srv.URL, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+func TestFaultSessionLimit(t *testing.T) {
+    srv := NewServer(Options{})
+    defer srv.Close()
+    srv.Inject(FaultRule{Fault: FaultSessionLimit, Request: "add login", Count: 1})
+
+    c, _ := me7k.NewClient(srv.URL, me7k.Options{User: "Admin"})
+    if _, err := c.Login(context.Background()); !errors.Is(err, me7k.ErrSessionLimit) {
+        t.Fatalf("first login: %v, want ErrSessionLimit", err)
+    }
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Errorf("second login: %v", err)
+    }
+    if n := srv.FaultHits(FaultSessionLimit); n != 1 {
+        t.Errorf("fault hit %d times, want 1", n)
+    }
+}
+
+func TestFaultResponses(t *testing.T) {
+    tests := []struct {
+        rule  FaultRule
+        check func(err error) bool
+    }{
+        // retried, as get requests are, so only the hits show
+        {FaultRule{Fault: FaultTruncated, Count: 1}, func(err error) bool { return err == nil }},
+        {FaultRule{Fault: FaultHTTP500}, func(err error) bool {
+            var se *me7k.StatusError
+            return errors.As(err, &se) && se.Code == 500
+        }},
+        {FaultRule{Fault: FaultMalformed}, func(err error) bool {
+            return err != nil && strings.Contains(err.Error(), "Unmarshal error")
+        }},
+        {FaultRule{Fault: FaultSlow, Delay: time.Second}, func(err error) bool {
+            return errors.Is(err, context.DeadlineExceeded)
+        }},
+        {FaultRule{Fault: FaultExpireSession}, func(err error) bool { return errors.Is(err, me7k.ErrInvalidSession) }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.rule.Fault.String(), func(t *testing.T) {
+            srv := NewServer(Options{})
+            defer srv.Close()
+            c := pullClient(t, srv, me7k.Options{Retry: quickRetry, RequestTimeout: 100 * time.Millisecond, DisableRelogin: true})
+
+            tt.rule.Request = "get event"
+            srv.Inject(tt.rule)
+            _, err := c.GetEvents(context.Background())
+            if !tt.check(err) {
+                t.Errorf("GetEvents: %v", err)
+            }
+            if srv.FaultHits(tt.rule.Fault) == 0 {
+                t.Errorf("fault not hit")
+            }
+        })
+    }
+}
+
+func TestFaultSkip(t *testing.T) {
+    srv := NewServer(Options{})
+    defer srv.Close()
+    c := pullClient(t, srv, me7k.Options{Retry: &me7k.RetryPolicy{MaxAttempts: 1}})
+    srv.Inject(FaultRule{Fault: FaultHTTP500, Request: "get event", Skip: 2, Count: 1})
+
+    for i, fails := range []bool{false, false, true, false} {
+        _, err := c.GetEvents(context.Background())
+        if (err != nil) != fails {
+            t.Errorf("get %d: %v", i+1, err)
+        }
+    }
+}
+
+func pushStream(t *testing.T, srv *Server) (*me7k.Client, *me7k.EventStream) {
+    ctx := context.Background()
+    c, _ := me7k.NewClient(srv.URL, me7k.Options{User: "Admin", SessionType: me7k.SessionPush})
+    if _, err := c.Login(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.SubscribeDevice(ctx, "ME-7000-1", me7k.HeartbeatEvent); err != nil {
+        t.Fatal(err)
+    }
+    s, err := c.AddChannel(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return c, s
+}
+
+// expect reads the next events of s and checks their ids, "gap" standing for the GapEventType event.
+func expect(t *testing.T, s *me7k.EventStream, ids ...string) {
+    t.Helper()
+    for _, want := range ids {
+        select {
+        case e, ok := <-s.Events():
+            if !ok {
+                t.Fatalf("stream ended (%v), want %s", s.Err(), want)
+            }
+            got := e.Id
+            if e.Type == me7k.GapEventType {
+                got = "gap"
+            }
+            if got != want {
+                t.Fatalf("got event %s, want %s", got, want)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("event %s not delivered", want)
+        }
+    }
+}
+
+func heartbeat(srv *Server, id string) {
+    srv.Publish(me7k.EventType{Type: string(me7k.HeartbeatEvent), Id: id})
+}
+
+func TestFaultDropChannel(t *testing.T) {
+    srv := NewServer(Options{})
+    defer srv.Close()
+    srv.Inject(FaultRule{Fault: FaultDropChannel, Request: "add channel", Count: 1, AfterEvents: 1})
+    c, s := pushStream(t, srv)
+    defer s.Close()
+
+    heartbeat(srv, "1")
+    heartbeat(srv, "2") // cut in the middle
+    heartbeat(srv, "3")
+    expect(t, s, "1", "gap", "3")
+
+    if sessions := srv.Sessions(); len(sessions) != 1 || sessions[0].SessionId != c.Session().SessionId {
+        t.Errorf("sessions = %+v, want the first one kept", sessions)
+    }
+}
+
+func TestFaultExpireSessionInStream(t *testing.T) {
+    srv := NewServer(Options{})
+    defer srv.Close()
+    srv.Inject(FaultRule{Fault: FaultExpireSession, Request: "add channel", Count: 1, AfterEvents: 2})
+    c, s := pushStream(t, srv)
+    defer s.Close()
+    first := c.Session().SessionId
+
+    heartbeat(srv, "1")
+    heartbeat(srv, "2")
+    expect(t, s, "1", "2", "gap") // logged in again and subscribed anew
+
+    if c.Session().SessionId == first {
+        t.Errorf("still on session %s", first)
+    }
+    heartbeat(srv, "3")
+    expect(t, s, "3")
+}
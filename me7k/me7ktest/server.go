@@ -0,0 +1,592 @@
+// Package me7ktest provides a fake ME-7000 controller for tests: an
+// httptest.Server speaking the neo protocol well enough for the me7k Client.
+package me7ktest
+
+import (
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "math/rand"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/beacham/go_client/me7k"
+)
+
+//
+// The Server implements the requests of the me7k Client:
+//
+//   add/remove/get login      log in, log out, keep alive
+//   get sessions              list the sessions, authenticated with the user
+//   add/remove subscription   device-wide events of a farmer, bit rate events of a line, mux or program
+//   get event                 the queued events of a pull session
+//   add channel               the events of a push session, streamed as they happen
+//   get alarm                 the alarms the device holds
+//
+// Like the device, it allows MaxSessions sessions, drops sessions idle for
+// longer than ActivityTimeout and answers requests with an unknown sid with
+// an error. Events are queued for the sessions subscribed to them, either by
+// the test calling Publish, PublishBitRates and the alarm methods, or by the
+// Server itself every EventInterval.
+//
+
+type Options struct {
+    Farmer          string        // farmer id of the device, "ME-7000-1" if empty
+    User            string        // accepted user, "Admin" if empty
+    Password        string        // accepted password
+    MaxSessions     int           // 8 if zero
+    ActivityTimeout time.Duration // 5 minutes if zero
+    ProtocolVersion string        // protocol-version of the responses, "2.2" if empty
+    SwVersion       string        // "me7k.2.2.0" if empty
+    EventInterval   time.Duration // generate bit rate and alarm events this often, 0 for never
+    Seed            int64         // seeds the generated bit rates and alarms
+}
+
+const (
+    maxEventsPerGet = 16   // events returned by one get event, the rest are pending
+    maxQueuedEvents = 4096 // a session that never fetches its events loses the oldest
+)
+
+type Server struct {
+    *httptest.Server
+
+    opts Options
+    done chan struct{} // closed by Close
+    wg   sync.WaitGroup
+
+    mu        sync.Mutex
+    sessions  map[string]*session
+    nextSid   int64
+    lastEvent int64 // id of the last event, in milliseconds since the epoch
+    alarms    map[string]*me7k.AlarmEntry
+    rand      *rand.Rand
+    rates     map[me7k.Path]int64 // base video bit rate of every subscribed target
+    ticks     int
+    faults    []*faultState // see faults.go
+}
+
+type session struct {
+    me7k.Session
+    user   string
+    origin string
+    last   time.Time
+
+    device   map[me7k.DeviceEventType]bool
+    bitRates map[me7k.Path]bool
+
+    queue   []me7k.EventType
+    wake    chan struct{} // signalled when events are queued
+    removed chan struct{} // closed when the session is removed
+    expired bool          // removed by the activity timeout rather than a logout
+    channel chan struct{} // closed to end the open add channel response, nil if none
+}
+
+//
+// NewServer starts a fake controller configured by opts. Close it when done;
+// its URL is the endpoint to give me7k.NewClient.
+//
+
+func NewServer(opts Options) *Server {
+    if opts.Farmer == "" {
+        opts.Farmer = "ME-7000-1"
+    }
+    if opts.User == "" {
+        opts.User = "Admin"
+    }
+    if opts.MaxSessions <= 0 {
+        opts.MaxSessions = 8
+    }
+    if opts.ActivityTimeout <= 0 {
+        opts.ActivityTimeout = 5 * time.Minute
+    }
+    if opts.ProtocolVersion == "" {
+        opts.ProtocolVersion = "2.2"
+    }
+    if opts.SwVersion == "" {
+        opts.SwVersion = "me7k.2.2.0"
+    }
+    s := &Server{
+        opts:     opts,
+        done:     make(chan struct{}),
+        sessions: make(map[string]*session),
+        nextSid:  949098745790,
+        alarms:   make(map[string]*me7k.AlarmEntry),
+        rand:     rand.New(rand.NewSource(opts.Seed)),
+        rates:    make(map[me7k.Path]int64),
+    }
+    s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+    if opts.EventInterval > 0 {
+        s.wg.Add(1)
+        go s.generate()
+    }
+    return s
+}
+
+//
+// Close ends the open add channel responses, stops generating events and
+// shuts the server down.
+//
+
+func (s *Server) Close() {
+    select {
+    case <-s.done:
+        return
+    default:
+    }
+    close(s.done)
+    s.wg.Wait()
+    s.Server.Close()
+}
+
+// Sessions returns the open sessions, oldest first.
+func (s *Server) Sessions() []me7k.Session {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.expire()
+
+    list := make([]me7k.Session, 0, len(s.sessions))
+    for _, ss := range s.sessions {
+        list = append(list, ss.info())
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].SessionId < list[j].SessionId })
+    return list
+}
+
+func (ss *session) info() me7k.Session {
+    info := ss.Session
+    info.UserName = ss.user
+    info.Origin = ss.origin
+    info.LastActivity = me7k.FormatTime(ss.last)
+    return info
+}
+
+//
+// request is any request of the Client, decoded far enough to serve it.
+//
+
+type request struct {
+    XMLName xml.Name `xml:"request"`
+    me7k.Envelope
+    User   me7k.User `xml:"user"`
+    Path   me7k.Path `xml:"path"`
+    Events []struct {
+        Type string `xml:"type,attr"`
+    } `xml:"event-list>event"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+    body, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    req := &request{}
+    if err := xml.Unmarshal(body, req); err != nil {
+        http.Error(w, "malformed request: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    s.mu.Lock()
+    f := s.fault(req)
+    s.mu.Unlock()
+    if f != nil && s.applyFault(w, r, req, f) {
+        return
+    }
+
+    if req.Command == "add" && req.Category == "channel" {
+        s.addChannel(w, r, req, f)
+        return
+    }
+
+    var rsp interface{}
+    switch req.Command + " " + req.Category {
+    case "add login":
+        rsp = s.login(r, req)
+    case "remove login":
+        rsp = s.logout(req)
+    case "get login":
+        rsp = s.keepAlive(req)
+    case "get sessions":
+        rsp = s.listSessions(req)
+    case "add subscription", "remove subscription":
+        rsp = s.subscription(req)
+    case "get event":
+        rsp = s.getEvents(req)
+    case "get alarm":
+        rsp = s.getAlarms(req)
+    default:
+        rsp = s.errorResponse(req, "Unsupported request %s %s.", req.Command, req.Category)
+    }
+
+    if f != nil && (f.Fault == FaultTruncated || f.Fault == FaultMalformed) {
+        out, err := encode(rsp)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        corrupt(w, out, f)
+        return
+    }
+    s.write(w, rsp)
+}
+
+// encode returns the response document for rsp, with the XML declaration on the same line like the device's.
+func encode(rsp interface{}) ([]byte, error) {
+    out, err := me7k.Marshal(rsp)
+    if err != nil {
+        return nil, err
+    }
+    return append([]byte(xml.Header[:len(xml.Header)-1]), out...), nil
+}
+
+func (s *Server) write(w http.ResponseWriter, rsp interface{}) {
+    out, err := encode(rsp)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+    w.Write(out)
+}
+
+// envelope returns the attributes of the response to req.
+func (s *Server) envelope(req *request) me7k.ResponseEnvelope {
+    return me7k.ResponseEnvelope{
+        Envelope: me7k.Envelope{
+            Id:          req.Id,
+            Origin:      "device",
+            Destination: req.Origin,
+            Command:     req.Command,
+            Category:    req.Category,
+            Time:        me7k.FormatTime(time.Now().UTC()),
+            Version:     s.opts.ProtocolVersion,
+            Platform:    "neo",
+        },
+        SwVersion: s.opts.SwVersion,
+        SwBuild:   "1",
+    }
+}
+
+// errorResponse is the device's answer to a request it refuses, always with code Unknown_Error.
+func (s *Server) errorResponse(req *request, format string, args ...interface{}) *me7k.Response {
+    env := s.envelope(req)
+    env.Status = "error"
+    return &me7k.Response{ResponseEnvelope: env, Reason: me7k.Reason{Code: "Unknown_Error", Message: fmt.Sprintf(format, args...)}}
+}
+
+func (s *Server) okResponse(req *request, message string) *me7k.Response {
+    return &me7k.Response{ResponseEnvelope: s.envelope(req), Reason: me7k.Reason{Code: "OK", Message: message}}
+}
+
+//
+// session returns the session of req after checking its sid, and marks it
+// active. The caller holds s.mu.
+//
+
+func (s *Server) session(req *request) (*session, *me7k.Response) {
+    s.expire()
+    ss, ok := s.sessions[req.SessionId]
+    if !ok {
+        return nil, s.errorResponse(req, "Invalid session id %s.", req.SessionId)
+    }
+    ss.last = time.Now()
+    return ss, nil
+}
+
+// expire removes the sessions idle for longer than the activity timeout. An open channel keeps a session alive.
+func (s *Server) expire() {
+    for sid, ss := range s.sessions {
+        if ss.channel == nil && time.Since(ss.last) > s.opts.ActivityTimeout {
+            s.expireSession(sid)
+        }
+    }
+}
+
+func (s *Server) remove(sid string) {
+    ss, ok := s.sessions[sid]
+    if !ok {
+        return
+    }
+    delete(s.sessions, sid)
+    close(ss.removed)
+}
+
+func (s *Server) login(r *http.Request, req *request) interface{} {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if req.User.Name != s.opts.User || req.User.Password != s.opts.Password {
+        return s.errorResponse(req, "Invalid user name or password.")
+    }
+    if req.User.Type != string(me7k.SessionPush) && req.User.Type != string(me7k.SessionPull) {
+        return s.errorResponse(req, "Invalid session type %q.", req.User.Type)
+    }
+    s.expire()
+    if len(s.sessions) >= s.opts.MaxSessions {
+        return s.errorResponse(req, "Number of sessions exceeded the maximum of %d.", s.opts.MaxSessions)
+    }
+
+    s.nextSid++
+    host, _, _ := net.SplitHostPort(r.RemoteAddr)
+    ss := &session{
+        Session: me7k.Session{
+            SessionId:       strconv.FormatInt(s.nextSid, 10),
+            Type:            req.User.Type,
+            ActivityTimeout: strconv.FormatInt(int64(s.opts.ActivityTimeout/time.Millisecond), 10),
+            AuthMethod:      "local",
+            FarmerId:        s.opts.Farmer,
+            ClientIp:        host,
+        },
+        user:     req.User.Name,
+        origin:   req.Origin,
+        last:     time.Now(),
+        device:   make(map[me7k.DeviceEventType]bool),
+        bitRates: make(map[me7k.Path]bool),
+        wake:     make(chan struct{}, 1),
+        removed:  make(chan struct{}),
+    }
+    s.sessions[ss.SessionId] = ss
+    return &me7k.LoginResponse{ResponseEnvelope: s.envelope(req), Session: ss.Session}
+}
+
+func (s *Server) logout(req *request) interface{} {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, errRsp := s.session(req); errRsp != nil {
+        return errRsp
+    }
+    s.remove(req.SessionId)
+    return s.okResponse(req, "succeeded")
+}
+
+func (s *Server) keepAlive(req *request) interface{} {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    ss, errRsp := s.session(req)
+    if errRsp != nil {
+        return errRsp
+    }
+    return &me7k.LoginResponse{ResponseEnvelope: s.envelope(req), Session: ss.Session}
+}
+
+func (s *Server) listSessions(req *request) interface{} {
+    if req.User.Name != s.opts.User || req.User.Password != s.opts.Password {
+        return s.errorResponse(req, "Invalid user name or password.")
+    }
+    return &me7k.SessionsResponse{ResponseEnvelope: s.envelope(req), Sessions: s.Sessions()}
+}
+
+func (s *Server) subscription(req *request) interface{} {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    ss, errRsp := s.session(req)
+    if errRsp != nil {
+        return errRsp
+    }
+    if req.Path.Valid() != nil || req.Path.Farmer() != s.opts.Farmer {
+        return s.errorResponse(req, "Invalid path %s.", req.Path)
+    }
+    if len(req.Events) == 0 {
+        return s.errorResponse(req, "No event in the event list.")
+    }
+
+    add := req.Command == "add"
+    for _, e := range req.Events {
+        if e.Type == me7k.BitRateEventType {
+            if req.Path.Level() < me7k.LevelGigeLine {
+                return s.errorResponse(req, "Invalid path %s for %s.", req.Path, e.Type)
+            }
+            if add {
+                ss.bitRates[req.Path] = true
+            } else {
+                delete(ss.bitRates, req.Path)
+            }
+            continue
+        }
+
+        t := me7k.DeviceEventType(e.Type)
+        if !t.Valid() {
+            return s.errorResponse(req, "Unknown event type %s.", e.Type)
+        }
+        if req.Path.Level() != me7k.LevelFarmer {
+            return s.errorResponse(req, "Invalid path %s for %s.", req.Path, e.Type)
+        }
+        if add {
+            ss.device[t] = true
+        } else {
+            delete(ss.device, t)
+        }
+    }
+
+    if add {
+        return s.okResponse(req, "succeeded.")
+    }
+    return s.okResponse(req, "unsuscribe completed.")
+}
+
+func (s *Server) getEvents(req *request) interface{} {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    ss, errRsp := s.session(req)
+    if errRsp != nil {
+        return errRsp
+    }
+    if ss.Type != string(me7k.SessionPull) {
+        return s.errorResponse(req, "Get event is only allowed for pull sessions.")
+    }
+
+    n := len(ss.queue)
+    if n > maxEventsPerGet {
+        n = maxEventsPerGet
+    }
+    rsp := &me7k.EventResponse{ResponseEnvelope: s.envelope(req)}
+    rsp.EventList.Events = append([]me7k.EventType(nil), ss.queue[:n]...)
+    ss.queue = ss.queue[n:]
+    rsp.PendingEvents = len(ss.queue)
+    return rsp
+}
+
+func (s *Server) getAlarms(req *request) interface{} {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, errRsp := s.session(req); errRsp != nil {
+        return errRsp
+    }
+    if req.Path.Valid() != nil || req.Path.Farmer() != s.opts.Farmer {
+        return s.errorResponse(req, "Invalid path %s.", req.Path)
+    }
+
+    rsp := &me7k.AlarmsResponse{ResponseEnvelope: s.envelope(req)}
+    for _, a := range s.alarms {
+        rsp.Alarms = append(rsp.Alarms, *a)
+    }
+    sort.Slice(rsp.Alarms, func(i, j int) bool { return rsp.Alarms[i].Id < rsp.Alarms[j].Id })
+    return rsp
+}
+
+//
+// addChannel streams the events of a push session until the session is
+// removed, the client goes away or the Server is closed. A second channel for
+// the same session ends the first. A session that expires ends its channel
+// with an invalid session error, as the device does.
+//
+// f, if not nil, hits the channel once it has delivered f.AfterEvents events.
+//
+
+func (s *Server) addChannel(w http.ResponseWriter, r *http.Request, req *request, f *FaultRule) {
+    s.mu.Lock()
+    ss, errRsp := s.session(req)
+    if errRsp == nil && ss.Type != string(me7k.SessionPush) {
+        errRsp = s.errorResponse(req, "Add channel is only allowed for push sessions.")
+    }
+    if errRsp != nil {
+        s.mu.Unlock()
+        s.write(w, errRsp)
+        return
+    }
+    if ss.channel != nil {
+        close(ss.channel)
+    }
+    channel := make(chan struct{})
+    ss.channel = channel
+    env := s.envelope(req)
+    s.mu.Unlock()
+
+    defer func() {
+        s.mu.Lock()
+        if ss.channel == channel {
+            ss.channel = nil
+            ss.last = time.Now()
+        }
+        s.mu.Unlock()
+    }()
+
+    head, _ := me7k.Marshal(&struct {
+        XMLName xml.Name `xml:"response"`
+        me7k.ResponseEnvelope
+    }{ResponseEnvelope: env})
+    head = head[:len(head)-len("/>")] // the start tag only, the events follow
+    w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+    fmt.Fprintf(w, "%s%s><event-list>", xml.Header[:len(xml.Header)-1], head)
+    flusher, _ := w.(http.Flusher)
+
+    delivered := 0
+    for {
+        if f != nil && f.Fault == FaultExpireSession && delivered >= f.AfterEvents {
+            s.mu.Lock()
+            s.expireSession(ss.SessionId)
+            s.mu.Unlock()
+            f = nil
+        }
+
+        s.mu.Lock()
+        events := ss.queue
+        ss.queue = nil
+        s.mu.Unlock()
+
+        for i := range events {
+            out, err := me7k.Marshal(&events[i])
+            if err != nil {
+                return
+            }
+            if f != nil && delivered == f.AfterEvents {
+                switch f.Fault {
+                case FaultDropChannel, FaultTruncated:
+                    s.mu.Lock()
+                    ss.queue = append(events[i+1:len(events):len(events)], ss.queue...) // only the cut event is lost
+                    s.mu.Unlock()
+                    dropChannel(w, out)
+                case FaultMalformed:
+                    out = bytes.Replace(out, []byte(`" `), []byte(` `), 1)
+                }
+            }
+            if _, err := w.Write(out); err != nil {
+                return
+            }
+            delivered++
+            if f != nil && f.Fault == FaultExpireSession && delivered >= f.AfterEvents {
+                break // expire before the next event
+            }
+        }
+        if flusher != nil {
+            flusher.Flush()
+        }
+        if f != nil && f.Fault == FaultExpireSession && delivered >= f.AfterEvents {
+            continue
+        }
+
+        select {
+        case <-ss.wake:
+        case <-ss.removed:
+            s.mu.Lock()
+            expired := ss.expired
+            s.mu.Unlock()
+            if expired {
+                fmt.Fprintf(w, `</event-list><reason error-code="Unknown_Error"><![CDATA[Invalid session id %s.]]></reason></response>`, ss.SessionId)
+                return
+            }
+            fmt.Fprint(w, "</event-list></response>")
+            return
+        case <-channel:
+            fmt.Fprint(w, "</event-list></response>")
+            return
+        case <-s.done:
+            fmt.Fprint(w, "</event-list></response>")
+            return
+        case <-r.Context().Done():
+            return
+        }
+    }
+}
@@ -0,0 +1,175 @@
+package me7ktest
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/beacham/go_client/me7k"
+)
+
+func newClient(t *testing.T, srv *Server, sessionType me7k.SessionType) *me7k.Client {
+    c, err := me7k.NewClient(srv.URL, me7k.Options{User: "Admin", SessionType: sessionType, DisableRelogin: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+func TestSessionLimit(t *testing.T) {
+    srv := NewServer(Options{})
+    defer srv.Close()
+    ctx := context.Background()
+
+    var clients []*me7k.Client
+    for i := 0; i < 8; i++ {
+        c := newClient(t, srv, me7k.SessionPull)
+        if _, err := c.Login(ctx); err != nil {
+            t.Fatalf("login %d: %v", i+1, err)
+        }
+        clients = append(clients, c)
+    }
+    if n := len(srv.Sessions()); n != 8 {
+        t.Fatalf("%d sessions, want 8", n)
+    }
+
+    _, err := newClient(t, srv, me7k.SessionPull).Login(ctx)
+    if !errors.Is(err, me7k.ErrSessionLimit) {
+        t.Fatalf("ninth login: %v, want ErrSessionLimit", err)
+    }
+
+    if err := clients[0].Logout(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := newClient(t, srv, me7k.SessionPull).Login(ctx); err != nil {
+        t.Errorf("login after logout: %v", err)
+    }
+}
+
+func TestInvalidSession(t *testing.T) {
+    srv := NewServer(Options{ActivityTimeout: 50 * time.Millisecond})
+    defer srv.Close()
+    ctx := context.Background()
+
+    c, _ := me7k.NewClient(srv.URL, me7k.Options{User: "Admin", DisableRelogin: true, DisableKeepAlive: true})
+    if _, err := c.Login(ctx); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(100 * time.Millisecond) // idle past the activity timeout
+
+    if _, err := c.GetEvents(ctx); !errors.Is(err, me7k.ErrInvalidSession) {
+        t.Errorf("GetEvents on expired session: %v, want ErrInvalidSession", err)
+    }
+    if n := len(srv.Sessions()); n != 0 {
+        t.Errorf("%d sessions left, want 0", n)
+    }
+}
+
+func TestPullBitRates(t *testing.T) {
+    srv := NewServer(Options{Farmer: "ME-7000-2", Seed: 1})
+    defer srv.Close()
+    ctx := context.Background()
+
+    c := newClient(t, srv, me7k.SessionPull)
+    if _, err := c.Login(ctx); err != nil {
+        t.Fatal(err)
+    }
+    mux := me7k.NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014")
+    if err := c.Subscribe(ctx, mux, me7k.EventBitRate{Type: me7k.BitRateEventType, GetAvgBr: "true"}); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Subscribe(ctx, me7k.NewPath("ME-7000-9").Board("4").GigeLine("4/3"), me7k.EventBitRate{Type: me7k.BitRateEventType}); !errors.Is(err, me7k.ErrUnknownPath) {
+        t.Errorf("subscribing another farmer: %v, want ErrUnknownPath", err)
+    }
+
+    for i := 0; i < 20; i++ {
+        srv.PublishBitRates()
+    }
+    rsp, err := c.GetEvents(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rsp.EventList.Events) != maxEventsPerGet || rsp.PendingEvents != 20-maxEventsPerGet {
+        t.Errorf("%d events, %d pending", len(rsp.EventList.Events), rsp.PendingEvents)
+    }
+    events, err := rsp.BitRateEvents()
+    if err != nil {
+        t.Fatal(err)
+    }
+    b := events[0]
+    if b.Path != mux || b.Mux.Id != "0014" || len(b.Mux.Programs) != 1 || len(b.Mux.Programs[0].Streams) != 3 {
+        t.Errorf("event = %+v", b)
+    }
+    if b.Mux.AvgBitRate <= b.Mux.Programs[0].AvgBitRate {
+        t.Errorf("mux rate %d not above program rate %d", b.Mux.AvgBitRate, b.Mux.Programs[0].AvgBitRate)
+    }
+
+    if err := c.Unsubscribe(ctx, mux); err != nil {
+        t.Fatal(err)
+    }
+    if n := srv.PublishBitRates(); n != 0 {
+        t.Errorf("%d events after unsubscribing", n)
+    }
+}
+
+func TestPushAlarms(t *testing.T) {
+    srv := NewServer(Options{ProtocolVersion: "2.1", SwVersion: "me7k.2.1.2"})
+    defer srv.Close()
+    ctx := context.Background()
+
+    c := newClient(t, srv, me7k.SessionPush)
+    if _, err := c.Login(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.SubscribeDevice(ctx, "ME-7000-1", me7k.AlarmAddedEvent, me7k.AlarmClearedEvent); err != nil {
+        t.Fatal(err)
+    }
+    tr := me7k.NewAlarmTracker()
+    existing := srv.RaiseAlarm("minor", "Fan speed")
+    if err := tr.Seed(ctx, c, "ME-7000-1"); err != nil {
+        t.Fatal(err)
+    }
+
+    s, err := c.AddChannel(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer s.Close()
+    <-s.Events() // the alarm-added-event of the seeded alarm
+
+    id := srv.RaiseAlarm("critical", "Input loss")
+    srv.ClearAlarm(existing)
+    srv.DeleteAlarm(id) // not subscribed, so not delivered
+
+    for _, want := range []string{"alarm-added-event", "alarm-cleared-event"} {
+        select {
+        case e := <-s.Events():
+            if e.Type != want {
+                t.Fatalf("got %s, want %s", e.Type, want)
+            }
+            d, err := e.Decode()
+            if err != nil {
+                t.Fatal(err)
+            }
+            tr.Apply("ME-7000-1", d)
+        case <-time.After(5 * time.Second):
+            t.Fatalf("%s not delivered", want)
+        }
+    }
+    if a, ok := tr.Alarm("ME-7000-1", id); !ok || a.Severity != "critical" || !a.Active() {
+        t.Errorf("raised alarm = %+v, %v", a, ok)
+    }
+    if a, ok := tr.Alarm("ME-7000-1", existing); !ok || a.Active() {
+        t.Errorf("cleared alarm = %+v, %v", a, ok)
+    }
+
+    if err := c.Logout(ctx); err != nil {
+        t.Fatal(err)
+    }
+    for range s.Events() {
+    }
+    if err := s.Err(); !errors.Is(err, me7k.ErrStreamClosed) {
+        t.Errorf("Err after logout = %v, want ErrStreamClosed", err)
+    }
+}
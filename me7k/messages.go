@@ -0,0 +1,353 @@
+package me7k
+
+import (
+    "encoding/xml"
+)
+
+//
+// XML messages exchanged with the ME-7000 neo API
+//
+
+/*
+ * Format of Login request:
+ *
+ * <request id="G1000" origin="gui" destination="device" command="add" category="login"
+ * time="2015-03-09T17:38:09.783-06:00" protocol- version=“2.3” platform-name="neo">
+ * <user name="Admin" password="" type="push"/>
+ * </request>
+ */
+
+type User struct {
+    XMLName   xml.Name `xml:"user"`          // XML tag
+    Name     string    `xml:"name,attr"`     // required
+    Password string    `xml:"password,attr"` // required
+    Type     string    `xml:"type,attr,omitempty"` // required for login, left out of get sessions
+}
+
+type LoginRequest struct {
+    XMLName xml.Name `xml:"request"`
+    Envelope
+    User User // struct
+}
+
+/*
+ * Format of Login response:
+ *
+ * <response id="G1000" origin="device" destination="gui" command="add" category="login"
+ * time="2015-03-09T17:38:09.783-06:00" protocol- version=“2.3” platform-name="neo" sw-
+ * version="me7k.2.3.0" sw-build="1">
+ * <session sid="949098745790" type="push" activity-timeout="300000" auth-method="local"
+ * farmer-id="Neo-180" client-ip="10.45.0.154" warning="Client time is ahead of controller
+ * time"/>
+ * </response>
+ */
+
+/* Note:
+2017/08/30 16:22:27 main - Response Body:
+ <?xml version="1.0" encoding="UTF-8"?><response id="beacham" origin="device" destination="transcoder-collector" command="add" category="login" time="2017-08-30T23:24:54.900Z" protocol-version="2.1" platform-name="neo" sw-version="me7k.2.1.2" sw-build="0" status="error"><reason error-code="Unknown_Error"><![CDATA[Number of sessions exceeded the maximum of 8.]]></reason></response>
+*/
+
+type LoginResponse struct {
+    XMLName xml.Name `xml:"response"`
+    ResponseEnvelope
+    Session Session `xml:"session"` // struct
+    Reason  Reason  `xml:"reason"`  // only on error
+}
+
+type Session struct {
+    XMLName         xml.Name `xml:"session"`
+    SessionId       string   `xml:"sid,attr"`
+    Type            string   `xml:"type,attr"`
+    ActivityTimeout string   `xml:"activity-timeout,attr"`
+    AuthMethod      string   `xml:"auth-method,attr"`
+    FarmerId        string   `xml:"farmer-id,attr"`
+    ClientIp        string   `xml:"client-ip,attr"`
+    Warning         string   `xml:"warning,attr"`
+    UserName        string   `xml:"user-name,attr,omitempty"`     // get sessions only
+    Origin          string   `xml:"origin,attr,omitempty"`        // get sessions only
+    LastActivity    string   `xml:"last-activity,attr,omitempty"` // get sessions only
+}
+
+//
+// While most event subscriptions are for device-wide events, the subscription for bit rate events must
+// be directed to either a line, a mux, or a program level target.
+//
+
+/*
+ * Format of add subscription (bit rate) request:
+ *
+ * <request id="G1201" origin="gui" destination="device" command="add" category="subscription"
+ * time="2016-02-09T11:30:20.508-06:00" protocol-2.3version=“2.3” platform-name="neo"
+ * sid="9223370581815793597">
+ * <path>
+ * <farmer id="ME-7000-2"/>
+ * <board id="4"/>
+ * <gige-line id="4/3"/>
+ * <gige-output-mux id="0014"/>
+ * <output-program id="1"/>
+ * </path>
+ * <event-list>
+ * <event type="bit-rate-event" get-streams="true" get-std-dev="true" get-inst-br="true"
+ * get-avg-br="true" get-video-info="true" get-audio-info="true"/>
+ * </event-list>
+ * </request>
+ */
+
+type BitRateRequest struct {
+    XMLName xml.Name `xml:"request"`
+    Envelope
+    Path  Path  `xml:"path"` // see path.go
+    Event Event // struct
+}
+
+// Every element under <path> and <event-list> is empty and is written self closed by Marshal.
+
+type Event struct {
+        XMLName      xml.Name     `xml:"event-list"` // XML tag
+        EventBitRate EventBitRate `xml:"event"` // struct
+}
+
+type EventBitRate struct {
+    XMLName      xml.Name `xml:"event"` // XML element tag
+    Type         string   `xml:"type,attr"`
+    GetStreams   string   `xml:"get-streams,attr,omitempty"`
+    GetStdDev    string   `xml:"get-std-dev,attr,omitempty"`
+    GetInstBr    string   `xml:"get-inst-br,attr,omitempty"`
+    GetAvgBr     string   `xml:"get-avg-br,attr,omitempty"` // the get-* flags are left out of remove requests
+    GetVideoInfo string   `xml:"get-video-info,attr,omitempty"` // program level only
+    GetAudioInfo string   `xml:"get-audio-info,attr,omitempty"` // program level only
+}
+
+/*
+* Format of remove subscription (bit rate) request: (Note: Identical to "add" so reuse the struct)
+ *
+ * <request id="G1204" origin="gui" destination="device" command="remove"
+ * category="subscription" time="2016-02-09T11:32:20.177-06:00" protocol-2.3version=“2.3”
+ * platform-name="neo" sid="9223370581815793597">
+ * <path>
+ * <farmer id="ME-7000-2"/>
+ * <board id="4"/>
+ * <gige-line id="4/3"/>
+ * <gige-output-mux id="0014"/>
+ * <output-program id="1"/>
+ * </path>
+ * <event-list>
+ * <event type="bit-rate-event"/>
+ * </event-list>
+ * </request>
+ *
+ */
+
+/*
+ * Format of remove subscription (bit rate) request: (Note: Identical to "add" so reuse the struct)
+ *
+ * <response id="G1204" origin="device" destination="gui" command="remove"
+ * category="subscription" time="2016-02-09T17:32:20.256Z" protocol-version=“2.3” platform-
+ * name="neo" sw-version="me7k.2.2.0" sw-build="1" sid="9223370581815793597">
+ * <reason error-code="OK"><![CDATA[unsuscribe completed.]]></reason>
+ * </response>
+ */
+
+/*
+ * Format of Get Event Request: (this is used only for sessions of type PULL)
+ *
+ * <request id='G1111' origin='gui' destination='device' command='get' category='event'
+ * time='Fri 2015-06-26T16:37:59.491Z ' protocol- version='1.0' platform-name='neo'
+ * sid='1435336628026'/>
+ */
+
+type EventRequest struct {
+    XMLName xml.Name `xml:"request"`
+    Envelope
+}
+
+/*
+ * Format of Get Event Response: (this is used only for sessions of type PULL)
+ *
+ * <response id="G1111" origin="device" destination="gui" command="get" category="event"
+ * time="2015-06-26T16:37:59.692Z" protocol-version=“2.3” platform-name="neo" sw-
+ * version="me7k.1.0.1" sw-build="1" pending-events="0">
+ * <event-list><event type="alarm-deleted-event" id="1435265291353"/>
+ * <event type="alarm-cleared-event" id="1435316297245" cleared- time="2015-06-
+ * 26T16:38:02.513Z"/>
+ * <event type="alarm-deleted-event" id="1435265291399"/>
+ * <event type="alarm-cleared-event" id="1435316297244" cleared- time="2015-06-
+ * 26T16:38:02.513Z"/>
+ * <event type="alarm-deleted-event" id="1435265291404"/>
+ * </event-list>
+ * </response>
+ */
+
+/*
+ * Format of Get Event Response: (when subscribed to bit rate event at mux level)
+ *
+ * <response id="beacham" origin="device" destination="transcoder-collector" command="get"
+ * category="event" time="2017-09-19T22:15:45.286Z" protocol-version="2.1" platform-name="neo"
+ * sw-version="me7k.2.1.2" sw-build="0" pending-events="0"><event-list><event type="bit-rate-event"
+ * id="1505838270680" time="2017-09-19T22:15:44.879Z">
+ * <path>
+ *   <farmer id="ME-7000-1"/>
+ *   <board id="4"/>
+ *   <gige-line id="4/3"/>
+ *   <gige-output-mux id="0000"/>
+ * </path>
+ * <gige-output-mux id="0000" avg-bit-rate="0" inst-bit-rate="0" overhead="0">
+ *   <output-program id="1" avg-bit-rate="0" inst-bit-rate="0">
+ *     <stream id="32" avg-bit-rate="0" inst-bit-rate="0" std-dev="0"/>
+ *     <stream id="33" avg-bit-rate="0" inst-bit-rate="0" std-dev="0"/>
+ *     <stream id="34" avg-bit-rate="0" inst-bit-rate="0" std-dev="0"/>
+ *   </output-program>
+ *    <passed-pids id="65536" avg-bit-rate="0" inst-bit-rate="0"/>
+ *   </gige-output-mux>
+ * </event></event-list></response>
+ */
+
+type EventResponse struct {
+    XMLName xml.Name `xml:"response"`
+    ResponseEnvelope
+    EventList EventList `xml:"event-list"` // struct
+    Reason    Reason    `xml:"reason"`     // only on error
+}
+
+type EventList struct {
+    XMLName xml.Name    `xml:"event-list"` // XML element tag
+    Events  []EventType `xml:"event"`      // array of type struct
+}
+
+//
+// EventType is one <event> of an event-list. Only the attributes common to
+// every event type are decoded here; the other attributes and the body are
+// kept so it can be decoded according to Type, see Decode in events.go.
+//
+
+type EventType struct {
+    XMLName xml.Name   `xml:"event"`
+    Type    string     `xml:"type,attr"`
+    Id      string     `xml:"id,attr"`
+    Time    string     `xml:"time,attr,omitempty"`
+    Attrs   []xml.Attr `xml:",any,attr"` // type specific, e.g. cleared-time
+    Inner   []byte     `xml:",innerxml"`
+}
+
+/*
+ * Format of Add Channel Event Request: (this is used only for sessions to type PUSH)
+ *
+ * <request id="G1168" origin="gui" destination="device" command="add" category="channel"
+ * time="2015-06-25T15:11:44.595Z" protocol-version=“2.3” platform-name="neo"
+ * sid="9223370601591671158"/>
+ */
+
+/*
+ * Format of Add Channel Event Response:
+ *
+ * <response id=" G1168" origin="device" destination="gui" command="add" category="channel"
+ * time="2015-06-25T15:11:44.627Z" protocol-version=“2.3” platform-name="neo" sw-
+ * version="me7k.1.0.1" sw-build="1" pending-events="0">
+ * <event-list>
+ * <event type="alarm-deleted-event" id="1435265291353"/>
+ * <event type="alarm-cleared-event" id="1435316297245" cleared- time="2015-06-
+ * 26T16:38:02.513Z"/>
+ * <event type="alarm-deleted-event" id="1435265291399"/>
+ * <event type="alarm-cleared-event" id="1435316297244" cleared- time="2015-06-
+ * 26T16:38:02.513Z"/>
+ * <event type="alarm-deleted-event" id="1435265291404"/>
+ * </event-list>
+ * </response>
+ */
+
+/*
+ * Format of Device wide subscription event request. Note: Bit rate events are NOT device wide.
+ *
+ * <request id="G1040" origin="gui" destination="device" command="add" category="subscription"
+ * time="2016-02-08T18:16:29.271-06:00" protocol-2.3version=“2.3” platform-name="neo"
+ * sid="1454976988853">
+ * <path>
+ * <farmer id="ME-7000-2"/>
+ * </path>
+ * <event-list>
+ * <event type="alarm-settings-event"/>
+ * <event type="configuration-event"/>
+ * <event type="db-status-event"/>
+ * <event type="heartbeat-event"/>
+ * <event type="schedule-notification-event"/>
+ * <event type="security-event"/>
+ * <event type="license-event"/>
+ * <event type="alarm-added-event"/>
+ * <event type="alarm-deleted-event"/>
+ * <event type="alarm-cleared-event"/>
+ * <event type="sw-update-event"/>
+ * </event-list>
+ * </request>
+ */
+
+type DeviceRequest struct {
+    XMLName xml.Name `xml:"request"`
+    Envelope
+    Path        Path `xml:"path"` // the farmer only, e.g. NewPath("ME-7000-2")
+    DeviceEvent DeviceEvent  // struct
+}
+
+type DeviceEvent struct {
+    XMLName xml.Name          `xml:"event-list"` // XML tag
+    Events  []DeviceEventItem `xml:"event"`      // one per event type, see device.go
+}
+
+type DeviceEventItem struct {
+    XMLName xml.Name        `xml:"event"` // XML element tag
+    Type    DeviceEventType `xml:"type,attr"`
+}
+
+/*
+ * Format of Subscription Event response
+ *
+ * <response id="G1040" origin="device" destination="gui" command="add" category="subscription"
+ * time="2016-02-09T00:16:29.464Z" protocol-version=“2.3” platform-name="neo" sw-
+ * version="me7k.2.2.0" sw-build="1">
+ * <reason error-code="OK"><![CDATA[succeeded.]]></reason>
+ * </response>
+ */
+
+/*
+ * Format of keep alive request, assumed: no sample of it is documented. Any request carrying the
+ * sid resets the activity timer, so this one just reads the session back.
+ *
+ * <request id="C1042" origin="transcoder-collector" destination="device" command="get" category="login"
+ * time="2017-09-19T15:20:44.879-07:00" protocol-version="2.1" platform-name="neo" sid="949098745790"/>
+ */
+
+type KeepAliveRequest struct {
+    XMLName xml.Name `xml:"request"`
+    Envelope
+}
+
+/*
+ * <request id="G1037" origin="gui" destination="device" command="remove" category="login"
+ * time="2015-03-09T17:38:29.783-06:00" protocol-version=“2.3” platform-name="neo"
+ * sid="949098745790">
+ * </request>
+ */
+
+type RemoveLoginRequest struct {
+    XMLName xml.Name `xml:"request"`
+    Envelope
+}
+
+/*
+ * <response id="G1037" origin="gui" destination="device" command="remove" category="login"
+ * time="2015-03-09T17:38:29.783-06:00" protocol- version=“2.3” platform-name="neo"
+ * sid="949098745790">
+ * <reason error-code="OK">succeeded</reason>
+ * </response>
+ */
+
+type RemoveLoginResponse struct {
+    XMLName xml.Name `xml:"response"`
+    ResponseEnvelope
+    Reason Reason `xml:"reason"` // struct
+}
+
+type Reason struct {
+    XMLName xml.Name `xml:"reason"`
+    Code    string   `xml:"error-code,attr"` // "OK" on success
+    Message string   `xml:",chardata"`       // the CDATA text, e.g. "succeeded."
+}
@@ -0,0 +1,234 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "fmt"
+    "strings"
+)
+
+/*
+ * A path addresses an object on the device from the farmer down:
+ *
+ * <path>
+ * <farmer id="ME-7000-2"/>
+ * <board id="4"/>
+ * <gige-line id="4/3"/>
+ * <gige-output-mux id="0014"/>
+ * <output-program id="1"/>
+ * </path>
+ *
+ * Device-wide requests stop at the farmer, bit rate subscriptions go down to
+ * a line, a mux or a program.
+ */
+
+// Level is the depth of an object in a Path.
+type Level int
+
+const (
+    LevelFarmer Level = iota
+    LevelBoard
+    LevelGigeLine
+    LevelGigeOutputMux
+    LevelOutputProgram
+
+    numLevels = iota
+)
+
+var levelTags = [numLevels]string{"farmer", "board", "gige-line", "gige-output-mux", "output-program"}
+
+func (l Level) String() string {
+    if l < 0 || l >= numLevels {
+        return fmt.Sprintf("Level(%d)", int(l))
+    }
+    return levelTags[l]
+}
+
+//
+// Path is the address of an object on the device. Paths are values and may be
+// compared with == or used as map keys. Build them from NewPath or ParsePath:
+//
+//    p := me7k.NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014")
+//
+
+type Path struct {
+    ids   [numLevels]string
+    depth int
+}
+
+// NewPath returns the path of a farmer, i.e. of the whole device.
+func NewPath(farmer string) Path {
+    return Path{}.At(LevelFarmer, farmer)
+}
+
+//
+// At returns p with the object at level set to id. Deeper levels of p are
+// dropped, so At can also be used to move sideways, e.g. to a sibling mux.
+//
+
+func (p Path) At(level Level, id string) Path {
+    if level < 0 || level >= numLevels {
+        panic(fmt.Sprintf("me7k: Path.At: bad level %d", level))
+    }
+    q := Path{depth: int(level) + 1}
+    copy(q.ids[:level], p.ids[:level])
+    q.ids[level] = id
+    return q
+}
+
+func (p Path) Board(id string) Path         { return p.At(LevelBoard, id) }
+func (p Path) GigeLine(id string) Path      { return p.At(LevelGigeLine, id) }
+func (p Path) GigeOutputMux(id string) Path { return p.At(LevelGigeOutputMux, id) }
+func (p Path) OutputProgram(id string) Path { return p.At(LevelOutputProgram, id) }
+
+// Depth returns the number of levels in p; 0 for the zero Path.
+func (p Path) Depth() int {
+    return p.depth
+}
+
+// Level returns the level of the object p addresses.
+func (p Path) Level() Level {
+    return Level(p.depth - 1)
+}
+
+// Id returns the id at level, or "" if p does not reach that deep.
+func (p Path) Id(level Level) string {
+    if level < 0 || int(level) >= p.depth {
+        return ""
+    }
+    return p.ids[level]
+}
+
+// Farmer returns the farmer id of p.
+func (p Path) Farmer() string {
+    return p.Id(LevelFarmer)
+}
+
+// Parent returns p without its deepest level.
+func (p Path) Parent() Path {
+    if p.depth == 0 {
+        return p
+    }
+    q := p
+    q.depth--
+    q.ids[q.depth] = ""
+    return q
+}
+
+// Valid reports an error if p is empty or has an empty id at some level.
+func (p Path) Valid() error {
+    if p.depth == 0 {
+        return fmt.Errorf("Path - empty path")
+    }
+    for l := 0; l < p.depth; l++ {
+        if p.ids[l] == "" {
+            return fmt.Errorf("Path - %s id missing in %q", Level(l), p.String())
+        }
+    }
+    return nil
+}
+
+//
+// Compact form: the ids from the farmer down, separated by "/". The "/" of a
+// gige-line id is written as "-", so ME-7000-2/4/4-3/0014/1 is program 1 of
+// mux 0014 on line 4/3 of board 4.
+//
+
+func (p Path) String() string {
+    ids := make([]string, p.depth)
+    for l := 0; l < p.depth; l++ {
+        ids[l] = p.ids[l]
+        if Level(l) == LevelGigeLine {
+            ids[l] = strings.Replace(ids[l], "/", "-", -1)
+        }
+    }
+    return strings.Join(ids, "/")
+}
+
+// ParsePath parses the compact form written by Path.String.
+func ParsePath(s string) (Path, error) {
+    parts := strings.Split(s, "/")
+    if len(parts) > numLevels {
+        return Path{}, fmt.Errorf("ParsePath - %q has more than %d levels", s, numLevels)
+    }
+
+    p := Path{depth: len(parts)}
+    for l, id := range parts {
+        if id == "" {
+            return Path{}, fmt.Errorf("ParsePath - %q has an empty %s id", s, Level(l))
+        }
+        if Level(l) == LevelGigeLine {
+            id = strings.Replace(id, "-", "/", -1)
+        }
+        p.ids[l] = id
+    }
+    return p, nil
+}
+
+// MarshalText and UnmarshalText use the compact form, e.g. for config files.
+func (p Path) MarshalText() ([]byte, error) {
+    return []byte(p.String()), nil
+}
+
+func (p *Path) UnmarshalText(text []byte) error {
+    q, err := ParsePath(string(text))
+    if err != nil {
+        return err
+    }
+    *p = q
+    return nil
+}
+
+//
+// XML form: <path> holding one empty element per level.
+//
+
+type pathElement struct {
+    XMLName xml.Name
+    Id      string `xml:"id,attr"`
+}
+
+func (p Path) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+    if err := p.Valid(); err != nil {
+        return err
+    }
+    start.Name = xml.Name{Local: "path"}
+    start.Attr = nil
+    if err := e.EncodeToken(start); err != nil {
+        return err
+    }
+    for l := 0; l < p.depth; l++ {
+        if err := e.Encode(pathElement{XMLName: xml.Name{Local: levelTags[l]}, Id: p.ids[l]}); err != nil {
+            return err
+        }
+    }
+    return e.EncodeToken(start.End())
+}
+
+func (p *Path) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+    var elements []pathElement
+    if err := d.DecodeElement(&struct {
+        Elements *[]pathElement `xml:",any"`
+    }{&elements}, &start); err != nil {
+        return err
+    }
+
+    q := Path{}
+    for _, el := range elements {
+        l := levelOf(el.XMLName.Local)
+        if l < 0 {
+            continue // an object we do not model
+        }
+        q = q.At(l, el.Id)
+    }
+    *p = q
+    return nil
+}
+
+func levelOf(tag string) Level {
+    for l, t := range levelTags {
+        if t == tag {
+            return Level(l)
+        }
+    }
+    return -1
+}
@@ -0,0 +1,69 @@
+package me7k
+
+import (
+    "encoding/xml"
+    "testing"
+)
+
+func TestPathCompactForm(t *testing.T) {
+    tests := []struct {
+        s    string
+        path Path
+    }{
+        {"ME-7000-2", NewPath("ME-7000-2")},
+        {"ME-7000-2/4", NewPath("ME-7000-2").Board("4")},
+        {"ME-7000-2/4/4-3", NewPath("ME-7000-2").Board("4").GigeLine("4/3")},
+        {"ME-7000-2/4/4-3/0014", NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014")},
+        {"ME-7000-2/4/4-3/0014/1", NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014").OutputProgram("1")},
+    }
+    for _, tt := range tests {
+        if got := tt.path.String(); got != tt.s {
+            t.Errorf("String() = %q, want %q", got, tt.s)
+        }
+        p, err := ParsePath(tt.s)
+        if err != nil || p != tt.path {
+            t.Errorf("ParsePath(%q) = %v, %v, want %v", tt.s, p, err, tt.path)
+        }
+    }
+
+    for _, s := range []string{"", "ME-7000-2//4-3", "a/b/c/d/e/f"} {
+        if _, err := ParsePath(s); err == nil {
+            t.Errorf("ParsePath(%q) succeeded", s)
+        }
+    }
+}
+
+func TestPathLevels(t *testing.T) {
+    p := NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014")
+    if p.Level() != LevelGigeOutputMux || p.Depth() != 4 || p.Id(LevelGigeLine) != "4/3" || p.Id(LevelOutputProgram) != "" {
+        t.Errorf("got %v level %v depth %d", p, p.Level(), p.Depth())
+    }
+    if q := p.GigeOutputMux("0015"); q.String() != "ME-7000-2/4/4-3/0015" {
+        t.Errorf("sibling = %v", q)
+    }
+    if q := p.Board("5"); q.String() != "ME-7000-2/5" {
+        t.Errorf("Board drops deeper levels: %v", q)
+    }
+    if q := p.Parent(); q != NewPath("ME-7000-2").Board("4").GigeLine("4/3") {
+        t.Errorf("Parent = %v", q)
+    }
+}
+
+func TestPathXML(t *testing.T) {
+    p := NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014").OutputProgram("1")
+    want := `<path><farmer id="ME-7000-2"/><board id="4"/><gige-line id="4/3"/><gige-output-mux id="0014"/><output-program id="1"/></path>`
+
+    got, err := Marshal(p)
+    if err != nil || string(got) != want {
+        t.Fatalf("Marshal = %s, %v, want %s", got, err, want)
+    }
+
+    var back Path
+    if err := xml.Unmarshal(got, &back); err != nil || back != p {
+        t.Errorf("Unmarshal = %v, %v, want %v", back, err, p)
+    }
+
+    if _, err := Marshal(Path{}.GigeLine("4/3")); err == nil {
+        t.Errorf("Marshal of a path with missing levels succeeded")
+    }
+}
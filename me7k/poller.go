@@ -0,0 +1,151 @@
+package me7k
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+const (
+    DefaultPollInterval    = 500 * time.Millisecond // poll interval while events are flowing
+    DefaultMaxPollInterval = 10 * time.Second       // poll interval the poller backs off to when idle
+)
+
+//
+// EventSource is implemented by the two ways of receiving events: the
+// EventStream of a push session and the Poller of a pull session.
+//
+
+type EventSource interface {
+    Events() <-chan EventType
+    Err() error
+    Close() error
+}
+
+//
+// Poller receives the events of a pull session. It sends get event requests
+// back to back while the device reports pending-events, and otherwise waits
+// between requests, doubling the wait up to MaxInterval while no events come.
+//
+
+type Poller struct {
+    c           *Client
+    ctx         context.Context
+    interval    time.Duration
+    maxInterval time.Duration
+
+    events chan EventType
+    done   chan struct{} // closed by Close
+
+    once sync.Once
+    mu   sync.Mutex
+    err  error
+}
+
+//
+// Poll starts polling for events. interval is the wait while events are
+// flowing and maxInterval the longest wait when idle; zero selects
+// DefaultPollInterval and DefaultMaxPollInterval. Cancelling ctx aborts the
+// request in progress and stops polling with the context's error.
+//
+
+func (c *Client) Poll(ctx context.Context, interval, maxInterval time.Duration) *Poller {
+    if interval <= 0 {
+        interval = DefaultPollInterval
+    }
+    if maxInterval < interval {
+        maxInterval = DefaultMaxPollInterval
+        if maxInterval < interval {
+            maxInterval = interval
+        }
+    }
+
+    p := &Poller{c: c, ctx: ctx, interval: interval, maxInterval: maxInterval,
+        events: make(chan EventType, 64), done: make(chan struct{})}
+    go p.run()
+    return p
+}
+
+// Events returns the channel events are delivered on. It is closed when polling stops.
+func (p *Poller) Events() <-chan EventType {
+    return p.events
+}
+
+// Err returns the error that stopped polling, or nil after Close. Only valid once Events is closed.
+func (p *Poller) Err() error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return p.err
+}
+
+// Close stops polling.
+func (p *Poller) Close() error {
+    p.once.Do(func() { close(p.done) })
+    return nil
+}
+
+func (p *Poller) run() {
+    defer close(p.events)
+
+    wait := p.interval
+    gen := p.c.generation()
+    timer := time.NewTimer(0) // first poll right away
+    defer timer.Stop()
+
+    for {
+        select {
+        case <-timer.C:
+        case <-p.done:
+            return
+        case <-p.ctx.Done():
+            p.fail(p.ctx.Err())
+            return
+        }
+
+        rsp, err := p.c.GetEvents(p.ctx)
+        if err != nil {
+            if p.ctx.Err() != nil {
+                err = p.ctx.Err()
+            }
+            p.fail(err)
+            return
+        }
+
+        if g := p.c.generation(); g != gen {
+            // logged in again since the last poll, events may be missing
+            gen = g
+            rsp.EventList.Events = append([]EventType{{Type: GapEventType, Time: FormatTime(time.Now())}}, rsp.EventList.Events...)
+        }
+
+        for _, e := range rsp.EventList.Events {
+            select {
+            case p.events <- e:
+            case <-p.done:
+                return
+            case <-p.ctx.Done():
+                p.fail(p.ctx.Err())
+                return
+            }
+        }
+
+        switch {
+        case rsp.PendingEvents > 0 && len(rsp.EventList.Events) > 0:
+            wait = 0 // drain the queue on the device
+        case len(rsp.EventList.Events) > 0:
+            wait = p.interval
+        default:
+            if wait < p.interval {
+                wait = p.interval
+            } else if wait *= 2; wait > p.maxInterval {
+                wait = p.maxInterval
+            }
+        }
+        timer.Reset(wait)
+    }
+}
+
+func (p *Poller) fail(err error) {
+    p.mu.Lock()
+    p.err = err
+    p.mu.Unlock()
+}
@@ -0,0 +1,102 @@
+package me7k
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestPollerDrainsPendingEvents(t *testing.T) {
+    var mu sync.Mutex
+    var polls []time.Time
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mu.Lock()
+        n := len(polls)
+        polls = append(polls, time.Now())
+        mu.Unlock()
+
+        pending, event := 0, ""
+        if n < 3 {
+            pending = 2 - n // three events queued, one returned per get
+            event = fmt.Sprintf(`<event type="heartbeat-event" id="%d"/>`, 1435265291353+n)
+        }
+        fmt.Fprintf(w, `<response id="C1" origin="device" destination="transcoder-collector" command="get" `+
+            `category="event" protocol-version="2.1" platform-name="neo" pending-events="%d"><event-list>%s</event-list></response>`,
+            pending, event)
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{})
+    p := c.Poll(context.Background(), 300*time.Millisecond, time.Second)
+
+    for i := 0; i < 3; i++ {
+        select {
+        case e := <-p.Events():
+            if want := fmt.Sprint(1435265291353 + i); e.Id != want {
+                t.Errorf("event %d id = %s, want %s", i, e.Id, want)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("event %d not delivered", i)
+        }
+    }
+    time.Sleep(1200 * time.Millisecond)
+    p.Close()
+    for range p.Events() {
+    }
+    if err := p.Err(); err != nil {
+        t.Errorf("Err = %v", err)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if len(polls) < 4 {
+        t.Fatalf("%d polls, want at least 4", len(polls))
+    }
+    if d := polls[2].Sub(polls[0]); d > 250*time.Millisecond {
+        t.Errorf("pending events drained in %v, want back to back requests", d)
+    }
+    if d := polls[3].Sub(polls[2]); d < 250*time.Millisecond {
+        t.Errorf("polled again after %v with nothing pending", d)
+    }
+    if len(polls) > 5 {
+        t.Errorf("%d polls in 1.5s, want the idle poller to back off", len(polls))
+    }
+}
+
+func TestPollerCancelled(t *testing.T) {
+    started := make(chan struct{}, 1)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ioutil.ReadAll(r.Body) // lets the server notice the client going away
+        select {
+        case started <- struct{}{}:
+        default:
+        }
+        <-r.Context().Done() // never answers, the poll must be aborted
+    }))
+    defer srv.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    c, _ := NewClient(srv.URL, Options{})
+    p := c.Poll(ctx, 0, 0)
+    <-started
+    cancel()
+
+    select {
+    case _, ok := <-p.Events():
+        if ok {
+            t.Fatal("event delivered after cancel")
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("poller not stopped by cancel")
+    }
+    if err := p.Err(); !errors.Is(err, context.Canceled) {
+        t.Errorf("Err = %v, want context.Canceled", err)
+    }
+}
@@ -0,0 +1,115 @@
+package me7k
+
+import (
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+//
+// The Client sends Options.Version as protocol-version of the login request.
+// The device answers with the protocol-version it speaks and its sw-version
+// (me7k.2.1.2 speaks 2.1, me7k.2.2.0 speaks 2.2). The Client then uses the
+// lower of the two for the rest of the session, and refuses a device older
+// than MinProtocolVersion instead of failing later on requests it does not
+// understand.
+//
+
+var (
+    MinProtocolVersion = ProtocolVersion{2, 1} // oldest version this package speaks
+    MaxProtocolVersion = ProtocolVersion{2, 2} // newest version this package speaks
+)
+
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+type ProtocolVersion struct {
+    Major, Minor int
+}
+
+//
+// ParseProtocolVersion parses a protocol-version like "2.1", or the leading
+// major.minor of a sw-version like "me7k.2.1.2".
+//
+
+func ParseProtocolVersion(s string) (ProtocolVersion, error) {
+    v := strings.TrimPrefix(strings.TrimSpace(s), "me7k.")
+    parts := strings.SplitN(v, ".", 3)
+    if len(parts) < 2 {
+        return ProtocolVersion{}, fmt.Errorf("ParseProtocolVersion - bad version %q", s)
+    }
+    major, err1 := strconv.Atoi(parts[0])
+    minor, err2 := strconv.Atoi(parts[1])
+    if err1 != nil || err2 != nil || major < 0 || minor < 0 {
+        return ProtocolVersion{}, fmt.Errorf("ParseProtocolVersion - bad version %q", s)
+    }
+    return ProtocolVersion{major, minor}, nil
+}
+
+func (v ProtocolVersion) String() string {
+    return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v ProtocolVersion) Less(o ProtocolVersion) bool {
+    return v.Major < o.Major || v.Major == o.Major && v.Minor < o.Minor
+}
+
+//
+// Dialect is the protocol negotiated with the device at login.
+//
+
+type Dialect struct {
+    Version   ProtocolVersion // sent as protocol-version of every request
+    Device    ProtocolVersion // what the device announced
+    SwVersion string          // e.g. "me7k.2.2.0"
+    SwBuild   string
+}
+
+//
+// negotiate picks the dialect for a device that answered a login request for
+// version preferred with rsp.
+//
+
+func negotiate(preferred ProtocolVersion, rsp *ResponseEnvelope) (Dialect, error) {
+    d := Dialect{SwVersion: rsp.SwVersion, SwBuild: rsp.SwBuild}
+
+    var err error
+    switch {
+    case rsp.Version != "":
+        d.Device, err = ParseProtocolVersion(rsp.Version)
+    case rsp.SwVersion != "":
+        d.Device, err = ParseProtocolVersion(rsp.SwVersion)
+    default:
+        d.Device = preferred // the device did not say, assume it accepted ours
+    }
+    if err != nil {
+        return d, fmt.Errorf("Login - %w: %v", ErrUnsupportedVersion, err)
+    }
+    if d.Device.Less(MinProtocolVersion) {
+        return d, fmt.Errorf("Login - %w: device %s speaks %s, at least %s is needed",
+            ErrUnsupportedVersion, rsp.SwVersion, d.Device, MinProtocolVersion)
+    }
+
+    d.Version = preferred
+    if d.Device.Less(preferred) {
+        d.Version = d.Device
+    }
+    return d, nil
+}
+
+// Dialect returns the protocol negotiated at the last login, or the zero Dialect before it.
+func (c *Client) Dialect() Dialect {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.dialect
+}
+
+// protocolVersion is the protocol-version to send: the negotiated one once logged in.
+func (c *Client) protocolVersion() string {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.dialect.Version == (ProtocolVersion{}) {
+        return c.opts.Version
+    }
+    return c.dialect.Version.String()
+}
@@ -0,0 +1,107 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+)
+
+// versionServer answers logins as a device running swVersion speaking protocol, and records every request.
+func versionServer(protocol, swVersion string) (*httptest.Server, func() []Envelope) {
+    var mu sync.Mutex
+    var seen []Envelope
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var env struct {
+            Envelope
+        }
+        xml.Unmarshal(body, &env)
+        mu.Lock()
+        seen = append(seen, env.Envelope)
+        mu.Unlock()
+
+        if env.Command == "add" && env.Category == "login" {
+            fmt.Fprintf(w, `<response command="add" category="login" protocol-version="%s" sw-version="%s" sw-build="0">`+
+                `<session sid="949098745790" type="pull"/></response>`, protocol, swVersion)
+            return
+        }
+        fmt.Fprintf(w, `<response command="%s" category="%s"><reason error-code="OK">succeeded.</reason></response>`, env.Command, env.Category)
+    }))
+    return srv, func() []Envelope {
+        mu.Lock()
+        defer mu.Unlock()
+        return append([]Envelope(nil), seen...)
+    }
+}
+
+func TestNegotiateDownToDevice(t *testing.T) {
+    srv, seen := versionServer("2.1", "me7k.2.1.2")
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{Version: "2.2", DisableKeepAlive: true})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    d := c.Dialect()
+    if d.Version != (ProtocolVersion{2, 1}) || d.SwVersion != "me7k.2.1.2" {
+        t.Errorf("negotiated %+v", d)
+    }
+    if _, err := c.Alarms(context.Background(), "ME-7000-2"); err != nil {
+        t.Errorf("Alarms on a 2.1 device: %v", err)
+    }
+    if err := c.Logout(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+
+    s := seen()
+    if s[0].Version != "2.2" || s[len(s)-1].Version != "2.1" {
+        t.Errorf("login sent %s, logout sent %s", s[0].Version, s[len(s)-1].Version)
+    }
+}
+
+func TestNegotiateFromSwVersion(t *testing.T) {
+    srv, _ := versionServer("", "me7k.2.2.0")
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{Version: "2.2", DisableKeepAlive: true})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if d := c.Dialect(); d.Version != (ProtocolVersion{2, 2}) {
+        t.Errorf("negotiated %+v", d)
+    }
+
+    c, _ = NewClient(srv.URL, Options{DisableKeepAlive: true})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if d := c.Dialect(); d.Version != (ProtocolVersion{2, 1}) {
+        t.Errorf("negotiated %+v by default, want 2.1", d)
+    }
+}
+
+func TestUnsupportedDevice(t *testing.T) {
+    srv, seen := versionServer("1.0", "me7k.1.0.1")
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{DisableKeepAlive: true})
+    if _, err := c.Login(context.Background()); !errors.Is(err, ErrUnsupportedVersion) {
+        t.Fatalf("Login to a 1.0 device: %v", err)
+    }
+    if c.Session().SessionId != "" {
+        t.Error("kept the session of an unsupported device")
+    }
+    if s := seen(); len(s) != 2 || s[1].Command != "remove" || s[1].SessionId != "949098745790" {
+        t.Errorf("session not removed, requests %+v", s)
+    }
+
+    if _, err := NewClient(srv.URL, Options{Version: "3.0"}); !errors.Is(err, ErrUnsupportedVersion) {
+        t.Errorf("NewClient accepted version 3.0: %v", err)
+    }
+}
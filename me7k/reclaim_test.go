@@ -0,0 +1,92 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fullDevice has no free session until one of the listed sessions is removed.
+func fullDevice(t *testing.T, removed *[]string, mu *sync.Mutex) *httptest.Server {
+    old := FormatTime(time.Now().Add(-time.Hour))
+    recent := FormatTime(time.Now())
+
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var env struct {
+            Envelope
+        }
+        xml.Unmarshal(body, &env)
+
+        mu.Lock()
+        defer mu.Unlock()
+        switch env.Command + " " + env.Category {
+        case "add login":
+            if len(*removed) == 0 {
+                fmt.Fprint(w, `<response command="add" category="login" status="error"><reason error-code="Unknown_Error">`+
+                    `<![CDATA[Number of sessions exceeded the maximum of 8.]]></reason></response>`)
+                return
+            }
+            fmt.Fprint(w, `<response command="add" category="login"><session sid="9" type="pull"/></response>`)
+        case "get sessions":
+            fmt.Fprint(w, `<response command="get" category="sessions"><session-list>`+
+                `<session sid="1" user-name="Admin" origin="transcoder-collector" client-ip="10.45.0.154" last-activity="`+old+`"/>`+
+                `<session sid="2" user-name="Admin" origin="gui" client-ip="10.45.0.154" last-activity="`+old+`"/>`+
+                `<session sid="3" user-name="Admin" origin="transcoder-collector" client-ip="10.45.0.200" last-activity="`+recent+`"/>`+
+                `<session sid="4" user-name="Operator" origin="transcoder-collector" client-ip="10.45.0.154" last-activity="`+old+`"/>`+
+                `<session sid="5" origin="transcoder-collector" client-ip="10.45.0.154" last-activity="`+old+`"/>`+
+                `</session-list></response>`)
+        case "remove login":
+            *removed = append(*removed, env.SessionId)
+            fmt.Fprint(w, `<response command="remove" category="login"><reason error-code="OK">succeeded.</reason></response>`)
+        default:
+            t.Errorf("unexpected request %s", body)
+        }
+    }))
+}
+
+func TestLoginReclaimsStaleSessions(t *testing.T) {
+    tests := []struct {
+        policy  *ReclaimPolicy
+        removed []string
+    }{
+        {nil, nil},
+        {&ReclaimPolicy{}, nil},
+        {&ReclaimPolicy{Origin: true}, []string{"1", "3"}},
+        {&ReclaimPolicy{Origin: true, MinIdle: 10 * time.Minute}, []string{"1"}},
+        {&ReclaimPolicy{ClientIp: "10.45.0.154"}, []string{"1", "2"}},
+    }
+
+    for _, tt := range tests {
+        var mu sync.Mutex
+        var removed []string
+        srv := fullDevice(t, &removed, &mu)
+
+        c, _ := NewClient(srv.URL, Options{User: "Admin", DisableKeepAlive: true, Reclaim: tt.policy})
+        s, err := c.Login(context.Background())
+
+        mu.Lock()
+        sort.Strings(removed)
+        if fmt.Sprint(removed) != fmt.Sprint(tt.removed) {
+            t.Errorf("%+v removed %v, want %v", tt.policy, removed, tt.removed)
+        }
+        mu.Unlock()
+
+        if tt.removed == nil {
+            if !errors.Is(err, ErrSessionLimit) {
+                t.Errorf("%+v: Login = %v, want ErrSessionLimit", tt.policy, err)
+            }
+        } else if err != nil || s.SessionId != "9" {
+            t.Errorf("%+v: Login = %v, %v", tt.policy, s, err)
+        }
+        srv.Close()
+    }
+}
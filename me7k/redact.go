@@ -0,0 +1,120 @@
+package me7k
+
+import (
+    "io"
+    "regexp"
+    "strings"
+    "sync"
+)
+
+//
+// Everything the Client writes to Options.Logger goes through a redactor:
+// password attributes and the password itself are replaced by *****, and
+// session ids, in sid attributes or anywhere in the text once the Client has
+// seen them, by their last four digits. That is enough to tell sessions apart
+// in a log without handing them to whoever reads it.
+//
+
+const redactedPassword = "*****"
+
+// RedactSessionId returns sid with all but its last four characters masked.
+func RedactSessionId(sid string) string {
+    if len(sid) <= 4 {
+        return strings.Repeat("*", len(sid))
+    }
+    return strings.Repeat("*", len(sid)-4) + sid[len(sid)-4:]
+}
+
+var (
+    passwordAttr = regexp.MustCompile(`(password=)("[^"]*"|'[^']*')`)
+    sidAttr      = regexp.MustCompile(`(sid=)"([^"]*)"`)
+)
+
+type redactor struct {
+    mu      sync.Mutex
+    secrets map[string]string // secret -> replacement
+}
+
+func (r *redactor) addSecret(secret, replacement string) {
+    if len(secret) < 4 {
+        return // too short to replace in free text without mangling it
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.secrets == nil {
+        r.secrets = make(map[string]string)
+    }
+    r.secrets[secret] = replacement
+}
+
+func (r *redactor) addSessionId(sid string) {
+    r.addSecret(sid, RedactSessionId(sid))
+}
+
+func (r *redactor) redact(s string) string {
+    s = passwordAttr.ReplaceAllString(s, `${1}"`+redactedPassword+`"`)
+    s = sidAttr.ReplaceAllStringFunc(s, func(m string) string {
+        sid := sidAttr.FindStringSubmatch(m)[2]
+        return `sid="` + RedactSessionId(sid) + `"`
+    })
+
+    r.mu.Lock()
+    pairs := make([]string, 0, 2*len(r.secrets))
+    for secret, replacement := range r.secrets {
+        pairs = append(pairs, secret, replacement)
+    }
+    r.mu.Unlock()
+    if len(pairs) > 0 {
+        s = strings.NewReplacer(pairs...).Replace(s)
+    }
+    return s
+}
+
+//
+// Redact masks s as the Client's log is masked. Use it for what is logged
+// elsewhere about the Client, like its errors, which carry the device's
+// messages and with them the session ids.
+//
+
+func (c *Client) Redact(s string) string {
+    return c.redact.redact(s)
+}
+
+//
+// redactedError is an error with its message masked as the Client's log is.
+// errors.Is and errors.As still see the error it masks.
+//
+
+type redactedError struct {
+    err error
+    msg string
+}
+
+func (e *redactedError) Error() string {
+    return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+    return e.err
+}
+
+// redactError masks err before it leaves the Client for the caller's logs, see Options.OnSessionLost and DeviceHealth.
+func (c *Client) redactError(err error) error {
+    if err == nil {
+        return nil
+    }
+    return &redactedError{err, c.redact.redact(err.Error())}
+}
+
+// redactWriter redacts every write before passing it on.
+type redactWriter struct {
+    r *redactor
+    w io.Writer
+}
+
+func (w redactWriter) Write(p []byte) (int, error) {
+    if _, err := io.WriteString(w.w, w.r.redact(string(p))); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
@@ -0,0 +1,169 @@
+package me7k
+
+import (
+    "context"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "io"
+    "math/rand"
+    "net"
+    "syscall"
+    "time"
+)
+
+//
+// A request that fails on the way, rather than being refused by the device,
+// is sent again under the Client's RetryPolicy, waiting a little longer each
+// time. Only get requests are retried after they may have reached the
+// device; add and remove requests change the device, so they are retried
+// only when the connection could not even be made. Errors the device or the
+// certificate check report are never retried.
+//
+// Every attempt has its own timeout: Options.Timeouts for its command and
+// category, or Options.RequestTimeout.
+//
+
+// DefaultRetryPolicy is used when Options.Retry is nil.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialDelay: 250 * time.Millisecond, MaxDelay: 5 * time.Second, Multiplier: 2, Jitter: 0.2}
+
+type RetryPolicy struct {
+    MaxAttempts  int           // attempts in all, 1 disables retrying
+    InitialDelay time.Duration // wait before the second attempt
+    MaxDelay     time.Duration // longest wait between attempts
+    Multiplier   float64       // growth of the wait per attempt, at least 1
+    Jitter       float64       // waits vary randomly by up to this fraction, 0 to 1
+}
+
+//
+// StatusError is an HTTP status other than 200 that the device did not
+// explain with an error response.
+//
+
+type StatusError struct {
+    Name string // the request, e.g. "GetEvents"
+    Code int
+}
+
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("%s - Status error: %v", e.Name, e.Code)
+}
+
+//
+// IsTransient reports whether err is a failure that may go away by itself: a
+// timeout, a broken or refused connection, or an overloaded device.
+//
+
+func IsTransient(err error) bool {
+    var ne *NeoError
+    var se *StatusError
+    var unknownAuthority x509.UnknownAuthorityError
+    var hostname x509.HostnameError
+    var invalid x509.CertificateInvalidError
+    var netErr net.Error
+
+    switch {
+    case err == nil:
+        return false
+    case errors.As(err, &ne):
+        return false // the device answered
+    case errors.As(err, &se):
+        switch se.Code {
+        case 429, 502, 503, 504:
+            return true
+        }
+        return false
+    case errors.Is(err, ErrCertificateMismatch), errors.As(err, &unknownAuthority),
+        errors.As(err, &hostname), errors.As(err, &invalid):
+        return false // retrying will not change the certificate
+    case errors.Is(err, context.Canceled):
+        return false
+    case errors.Is(err, context.DeadlineExceeded), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+        errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+        return true
+    case errors.As(err, &netErr) && netErr.Timeout(), notSent(err):
+        return true // not every net.Error, a *url.Error is one whatever it wraps
+    }
+    return false
+}
+
+// notSent reports whether err means the request never left, so even a mutating request can be sent again.
+func notSent(err error) bool {
+    var op *net.OpError
+    return errors.As(err, &op) && op.Op == "dial"
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+    d := float64(p.InitialDelay)
+    for i := 1; i < attempt; i++ {
+        if d *= p.Multiplier; d > float64(p.MaxDelay) {
+            d = float64(p.MaxDelay)
+            break
+        }
+    }
+    if p.Jitter > 0 {
+        d *= 1 + p.Jitter*(2*rand.Float64()-1)
+    }
+    return time.Duration(d)
+}
+
+func (c *Client) retryPolicy() RetryPolicy {
+    p := DefaultRetryPolicy
+    if c.opts.Retry != nil {
+        p = *c.opts.Retry
+    }
+    if p.MaxAttempts < 1 {
+        p.MaxAttempts = 1
+    }
+    if p.Multiplier < 1 {
+        p.Multiplier = 1
+    }
+    if p.MaxDelay < p.InitialDelay {
+        p.MaxDelay = p.InitialDelay
+    }
+    return p
+}
+
+// timeout returns the timeout of one attempt of req.
+func (c *Client) timeout(req request) time.Duration {
+    e := req.envelope()
+    if t, ok := c.opts.Timeouts[e.Command+" "+e.Category]; ok && t > 0 {
+        return t
+    }
+    return c.opts.RequestTimeout
+}
+
+//
+// send sends req, retrying as described above, and returns the response body.
+//
+
+func (c *Client) send(ctx context.Context, name string, req request) ([]byte, error) {
+    p := c.retryPolicy()
+    idempotent := req.envelope().Command == "get"
+    timeout := c.timeout(req)
+
+    for attempt := 1; ; attempt++ {
+        actx, cancel := context.WithTimeout(ctx, timeout)
+        body, err := c.sendOnce(actx, name, req)
+        cancel()
+        if err == nil {
+            return body, nil
+        }
+
+        retry := IsTransient(err) && (idempotent || notSent(err))
+        if !retry || attempt >= p.MaxAttempts || ctx.Err() != nil {
+            if attempt > 1 {
+                err = fmt.Errorf("%w (gave up after %d attempts)", err, attempt)
+            }
+            return nil, err
+        }
+
+        wait := p.delay(attempt)
+        c.log.Printf("%s - attempt %d failed, retrying in %v: %v", name, attempt, wait, err)
+        select {
+        case <-time.After(wait):
+        case <-ctx.Done():
+            return nil, err
+        }
+    }
+}
@@ -0,0 +1,136 @@
+package me7k
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "sync"
+    "syscall"
+    "testing"
+    "time"
+)
+
+// flakyServer fails the first failures requests of each command/category with 503.
+func flakyServer(failures int, delay time.Duration) (*httptest.Server, func(string) int) {
+    var mu sync.Mutex
+    count := map[string]int{}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var env struct {
+            Envelope
+        }
+        xml.Unmarshal(body, &env)
+        key := env.Command + " " + env.Category
+
+        mu.Lock()
+        count[key]++
+        n := count[key]
+        mu.Unlock()
+
+        if n <= failures {
+            http.Error(w, "busy", http.StatusServiceUnavailable)
+            return
+        }
+        time.Sleep(delay)
+        fmt.Fprintf(w, `<response command="%s" category="%s"><reason error-code="OK">succeeded.</reason></response>`, env.Command, env.Category)
+    }))
+    return srv, func(key string) int {
+        mu.Lock()
+        defer mu.Unlock()
+        return count[key]
+    }
+}
+
+func TestRetryIdempotentOnly(t *testing.T) {
+    srv, count := flakyServer(2, 0)
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{Retry: &RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond, Multiplier: 2, Jitter: 0.5}})
+    if _, err := c.GetEvents(context.Background()); err != nil {
+        t.Errorf("get event after two 503s: %v", err)
+    }
+    if n := count("get event"); n != 3 {
+        t.Errorf("get event sent %d times", n)
+    }
+
+    err := c.Subscribe(context.Background(), NewPath("ME-7000-2").Board("4").GigeLine("4/3"), EventBitRate{Type: BitRateEventType})
+    var se *StatusError
+    if !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+        t.Errorf("subscription: %v", err)
+    }
+    if n := count("add subscription"); n != 1 {
+        t.Errorf("add subscription sent %d times", n)
+    }
+}
+
+func TestRetryGivesUp(t *testing.T) {
+    srv, count := flakyServer(10, 0)
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{Retry: &RetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond}})
+    if _, err := c.GetEvents(context.Background()); !IsTransient(err) {
+        t.Errorf("expected a transient error, got %v", err)
+    }
+    if n := count("get event"); n != 2 {
+        t.Errorf("get event sent %d times", n)
+    }
+}
+
+func TestPerCallTimeout(t *testing.T) {
+    srv, _ := flakyServer(0, 100*time.Millisecond)
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{RequestTimeout: time.Second, Retry: &RetryPolicy{MaxAttempts: 1},
+        Timeouts: map[string]time.Duration{"get event": 20 * time.Millisecond}})
+    if _, err := c.GetEvents(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("get event with a 20ms timeout: %v", err)
+    }
+    if err := c.Unsubscribe(context.Background(), NewPath("ME-7000-2").Board("4").GigeLine("4/3")); err != nil {
+        t.Errorf("remove subscription with the default timeout: %v", err)
+    }
+}
+
+func TestClassifyErrors(t *testing.T) {
+    l, _ := net.Listen("tcp", "127.0.0.1:0")
+    addr := l.Addr().String()
+    l.Close()
+    _, dialErr := net.Dial("tcp", addr)
+    _, schemeErr := http.Post("neo://"+addr, "text/xml", nil)
+    post := func(err error) error { return &url.Error{Op: "Post", URL: "https://" + addr, Err: err} }
+
+    for _, tc := range []struct {
+        err       error
+        transient bool
+        notSent   bool
+    }{
+        {dialErr, true, true},
+        {&StatusError{"GetEvents", 503}, true, false},
+        {&StatusError{"GetEvents", 400}, false, false},
+        {newNeoError("event", "get", "Unknown_Error", "Invalid session id 1."), false, false},
+        {fmt.Errorf("x: %w", context.DeadlineExceeded), true, false},
+        {context.Canceled, false, false},
+        {fmt.Errorf("TLS: %w", ErrCertificateMismatch), false, false},
+        {post(dialErr), true, true},
+        {post(&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}), true, false},
+        {post(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), true, false},
+        {schemeErr, false, false},
+        {post(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), false, false},
+        {post(x509.UnknownAuthorityError{}), false, false},
+    } {
+        if got := IsTransient(tc.err); got != tc.transient {
+            t.Errorf("IsTransient(%v) = %v", tc.err, got)
+        }
+        if got := notSent(tc.err); got != tc.notSent {
+            t.Errorf("notSent(%v) = %v", tc.err, got)
+        }
+    }
+}
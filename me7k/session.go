@@ -0,0 +1,150 @@
+package me7k
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+)
+
+//
+// A session can disappear under the Client: the device reboots, the activity
+// timeout expires or an administrator removes it. The device then answers
+// with an invalid session error. Unless Options.DisableRelogin is set, the
+// Client logs in again with the same credentials and session type, re-issues
+// every subscription still active and retries the failed request.
+//
+// Events may have been missed in between. Pollers and event streams report
+// this with an event of type GapEventType, and Options.OnRelogin is called.
+//
+
+// GapEventType is the type of the synthetic event delivered after a re-login. The device never sends it.
+const GapEventType = "session-gap-event"
+
+//
+// request is implemented by every request type through its embedded Envelope.
+//
+
+type request interface {
+    envelope() *Envelope
+}
+
+func (e *Envelope) envelope() *Envelope {
+    return e
+}
+
+//
+// subscription is an active subscription, kept so it can be replayed on a new
+// session and removed on shutdown. add and remove build the requests that
+// create and delete it on the current session.
+//
+
+type subscription struct {
+    name   string
+    add    func() request
+    remove func() request
+    events []DeviceEventType // device-wide subscriptions only
+}
+
+func (c *Client) addSubscription(key string, s subscription) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.subs == nil {
+        c.subs = make(map[string]subscription)
+    }
+    c.subs[key] = s
+}
+
+func (c *Client) removeSubscription(key string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    delete(c.subs, key)
+}
+
+// generation counts re-logins, so event readers can tell that one happened.
+func (c *Client) generation() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.gen
+}
+
+//
+// relogin replaces the session failedSid with a new one and replays the
+// subscriptions. If another goroutine already replaced it, relogin returns at
+// once.
+//
+
+func (c *Client) relogin(ctx context.Context, failedSid string) error {
+    c.reloginMu.Lock()
+    defer c.reloginMu.Unlock()
+
+    if c.sessionId() != failedSid {
+        return nil // somebody else got there first
+    }
+    c.log.Printf("Relogin - session %s is gone, logging in again", failedSid)
+
+    s, err := c.Login(ctx)
+    if err != nil {
+        return fmt.Errorf("Relogin - %w", err)
+    }
+
+    c.mu.Lock()
+    c.gen++
+    subs := make([]subscription, 0, len(c.subs))
+    for _, sub := range c.subs {
+        subs = append(subs, sub)
+    }
+    c.mu.Unlock()
+
+    var failed []error
+    for _, sub := range subs {
+        if err := c.callOnce(ctx, "Relogin", sub.add(), nil); err != nil {
+            failed = append(failed, fmt.Errorf("%s: %w", sub.name, err))
+        }
+    }
+
+    if c.opts.OnRelogin != nil {
+        c.opts.OnRelogin(failedSid, s.SessionId)
+    }
+    if len(failed) > 0 {
+        return fmt.Errorf("Relogin - replaying subscriptions: %w", errors.Join(failed...))
+    }
+    return nil
+}
+
+//
+// call sends req and decodes the reply into rsp, which may be nil when only
+// success or failure matters. A reply with status="error" or a reason other
+// than "OK" is returned as a *NeoError. A request refused for an invalid
+// session is retried once on a new session.
+//
+
+func (c *Client) call(ctx context.Context, name string, req request, rsp interface{}) error {
+    err := c.callOnce(ctx, name, req, rsp)
+
+    sid := req.envelope().SessionId
+    if err == nil || sid == "" || c.opts.DisableRelogin || !errors.Is(err, ErrInvalidSession) {
+        return err
+    }
+    if rerr := c.relogin(ctx, sid); rerr != nil && c.sessionId() == sid {
+        return fmt.Errorf("%w (%v)", err, rerr)
+    }
+
+    e := req.envelope()
+    e.Id = nextRequestId(c.opts.RequestIdPrefix)
+    e.Time = FormatTime(time.Now())
+    e.SessionId = c.sessionId()
+    return c.callOnce(ctx, name, req, rsp)
+}
+
+func (c *Client) callOnce(ctx context.Context, name string, req request, rsp interface{}) error {
+    body, err := c.send(ctx, name, req)
+    if err != nil {
+        return err
+    }
+    if err := decodeResponse(name, body, rsp); err != nil {
+        return err // an error reply does not keep the session alive
+    }
+    c.active()
+    return nil
+}
@@ -0,0 +1,88 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestReloginReplaysSubscriptions(t *testing.T) {
+    var mu sync.Mutex
+    sid := 0
+    var log []string // "command category sid" of every request
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var env struct {
+            Envelope
+        }
+        xml.Unmarshal(body, &env)
+
+        mu.Lock()
+        defer mu.Unlock()
+        log = append(log, fmt.Sprintf("%s %s %s", env.Command, env.Category, env.SessionId))
+
+        if env.Category == "login" && env.Command == "add" {
+            sid++
+            fmt.Fprintf(w, `<response command="add" category="login"><session sid="%d" type="pull"/></response>`, sid)
+            return
+        }
+        if env.SessionId != fmt.Sprint(sid) || sid == 1 && env.Category == "event" {
+            // the device rebooted after the subscription was made
+            fmt.Fprintf(w, `<response command="%s" category="%s" status="error"><reason error-code="Unknown_Error">`+
+                `<![CDATA[Invalid session id %s.]]></reason></response>`, env.Command, env.Category, env.SessionId)
+            return
+        }
+        if env.Category == "event" {
+            fmt.Fprint(w, `<response command="get" category="event"><event-list><event type="heartbeat-event" id="1435265291353"/></event-list></response>`)
+            return
+        }
+        fmt.Fprintf(w, `<response command="%s" category="%s"><reason error-code="OK">succeeded.</reason></response>`, env.Command, env.Category)
+    }))
+    defer srv.Close()
+
+    relogins := make(chan string, 1)
+    c, _ := NewClient(srv.URL, Options{DisableKeepAlive: true, OnRelogin: func(oldSid, newSid string) {
+        relogins <- oldSid + "->" + newSid
+    }})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    path := NewPath("ME-7000-2").Board("4").GigeLine("4/3").GigeOutputMux("0014")
+    if err := c.Subscribe(context.Background(), path, EventBitRate{Type: BitRateEventType, GetInstBr: "true"}); err != nil {
+        t.Fatal(err)
+    }
+
+    p := c.Poll(context.Background(), time.Second, time.Second)
+    defer p.Close()
+
+    for _, want := range []string{GapEventType, "heartbeat-event"} {
+        select {
+        case e := <-p.Events():
+            if e.Type != want {
+                t.Errorf("got %s event, want %s", e.Type, want)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("no %s event: %v", want, p.Err())
+        }
+    }
+    if got := <-relogins; got != "1->2" {
+        t.Errorf("OnRelogin %s", got)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    want := []string{
+        "add login ", "add subscription 1", "get event 1", // session 1 is lost here
+        "add login ", "add subscription 2", "get event 2",
+    }
+    if fmt.Sprint(log[:len(want)]) != fmt.Sprint(want) {
+        t.Errorf("requests:\n got %q\nwant %q", log, want)
+    }
+}
@@ -0,0 +1,80 @@
+package me7k
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "time"
+)
+
+//
+// Subscriptions and sessions left on the device count against its limits
+// until they time out, so a collector should always clean up, even when it is
+// interrupted. Shutdown removes every active subscription and then the login
+// session, carrying on past failures, and reports each step.
+//
+
+// DefaultShutdownTimeout bounds Shutdown when its context has no deadline.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// CleanupResult is the outcome of one step of Shutdown.
+type CleanupResult struct {
+    Step string // what was removed, e.g. "bit rate subscription ME-7000-2/4/4-3/0000"
+    Err  error  // nil if the device confirmed the removal
+}
+
+func (r CleanupResult) String() string {
+    if r.Err != nil {
+        return fmt.Sprintf("remove %s: %v", r.Step, r.Err)
+    }
+    return fmt.Sprintf("remove %s: ok", r.Step)
+}
+
+//
+// Shutdown makes a best effort to remove every subscription and to log out,
+// giving up when ctx is done. The session is not replaced if it turns out to
+// be lost. Shutdown returns nothing if the Client is not logged in.
+//
+
+func (c *Client) Shutdown(ctx context.Context) []CleanupResult {
+    if _, ok := ctx.Deadline(); !ok {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, DefaultShutdownTimeout)
+        defer cancel()
+    }
+
+    c.stopKeepAlive()
+
+    c.mu.Lock()
+    sid := c.session.SessionId
+    keys := make([]string, 0, len(c.subs))
+    for k := range c.subs {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    subs := make([]subscription, len(keys))
+    for i, k := range keys {
+        subs[i] = c.subs[k]
+    }
+    c.subs = nil
+    c.mu.Unlock()
+
+    if sid == "" {
+        return nil
+    }
+
+    var results []CleanupResult
+    for _, sub := range subs {
+        err := c.callOnce(ctx, "Shutdown", sub.remove(), nil)
+        results = append(results, CleanupResult{Step: sub.name, Err: err})
+    }
+
+    err := c.callOnce(ctx, "Shutdown", &RemoveLoginRequest{Envelope: c.envelope("remove", "login")}, nil)
+    results = append(results, CleanupResult{Step: "login session " + sid, Err: err})
+
+    c.mu.Lock()
+    c.session = Session{}
+    c.mu.Unlock()
+
+    return results
+}
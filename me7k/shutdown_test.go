@@ -0,0 +1,69 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestShutdownRemovesEverything(t *testing.T) {
+    var requests []string
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var req struct {
+            Envelope
+            Path Path `xml:"path"`
+        }
+        xml.Unmarshal(body, &req)
+        requests = append(requests, strings.TrimSpace(req.Command+" "+req.Category+" "+req.Path.String()))
+
+        switch {
+        case req.Command == "add" && req.Category == "login":
+            fmt.Fprint(w, `<response command="add" category="login"><session sid="949098745790" type="pull"/></response>`)
+        case req.Command == "remove" && req.Path.Id(LevelGigeOutputMux) == "0001":
+            fmt.Fprint(w, `<response command="remove" category="subscription" status="error">`+
+                `<reason error-code="Unknown_Error"><![CDATA[The path does not exist.]]></reason></response>`)
+        default:
+            fmt.Fprintf(w, `<response command="%s" category="%s"><reason error-code="OK">succeeded.</reason></response>`, req.Command, req.Category)
+        }
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{DisableKeepAlive: true})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    line := NewPath("ME-7000-2").Board("4").GigeLine("4/3")
+    for _, mux := range []string{"0000", "0001"} {
+        if err := c.Subscribe(context.Background(), line.GigeOutputMux(mux), EventBitRate{Type: BitRateEventType}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := c.Unsubscribe(context.Background(), line.GigeOutputMux("0001")); err == nil {
+        t.Fatal("Unsubscribe succeeded") // the subscription stays, Shutdown tries again
+    }
+    requests = nil
+
+    results := c.Shutdown(context.Background())
+
+    want := []string{
+        "remove bit rate subscription ME-7000-2/4/4-3/0000: ok",
+        "remove bit rate subscription ME-7000-2/4/4-3/0001: remove subscription failed: Unknown_Error: The path does not exist.",
+        "remove login session 949098745790: ok",
+    }
+    if fmt.Sprint(results) != fmt.Sprint(want) {
+        t.Errorf("results:\n got %v\nwant %v", results, want)
+    }
+    if len(requests) != 3 || requests[2] != "remove login" {
+        t.Errorf("requests %q", requests)
+    }
+    if c.Session().SessionId != "" || c.Shutdown(context.Background()) != nil {
+        t.Errorf("still logged in after Shutdown")
+    }
+}
@@ -0,0 +1,285 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "sync"
+    "time"
+)
+
+/*
+ * Note: The add channel request is blocked by the Controller and as events are generated, they
+ * are immediately written to the socket output stream. The caller receives responses by reading the
+ * information from the underlying client socket. A client must monitor the socket input stream to read
+ * the events as they arrive. The call remains blocked on the device until the session is terminated.
+ *
+ * The body is one <response> whose <event-list> grows as events happen, so it is read with a
+ * streaming xml.Decoder and every <event> is handed on as soon as its end tag arrives.
+ */
+
+// ErrStreamClosed is returned by EventStream.Err when the device ended the stream.
+var ErrStreamClosed = errors.New("event stream closed by device")
+
+//
+// EventStream delivers the events of a push session as they arrive. When the
+// channel breaks, the stream opens a new one, logging in again first if the
+// session is gone (see session.go), and delivers a GapEventType event.
+//
+// Cancelling the context passed to AddChannel aborts the read in progress and
+// ends the stream like Close, with the context's error as Err.
+//
+
+type EventStream struct {
+    c      *Client
+    ctx    context.Context
+    events chan EventType
+    done   chan struct{} // closed by Close
+
+    once sync.Once
+    mu   sync.Mutex
+    body io.ReadCloser // the current add channel response
+    err  error
+}
+
+const (
+    streamRetries    = 3           // reopen attempts in a row without an event in between
+    streamRetryDelay = time.Second // wait before reopening a broken channel
+)
+
+//
+// AddChannel opens the event channel of a push session. Events are delivered
+// on the stream's Events channel until the device ends the session or Close
+// is called.
+//
+
+func (c *Client) AddChannel(ctx context.Context) (*EventStream, error) {
+    body, sid, err := c.openChannel(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    s := &EventStream{c: c, ctx: ctx, events: make(chan EventType, 64), body: body, done: make(chan struct{})}
+    go s.run(sid)
+    go s.watch()
+    return s, nil
+}
+
+func (c *Client) openChannel(ctx context.Context) (io.ReadCloser, string, error) {
+    a := &EventRequest{Envelope: c.envelope("add", "channel")}
+
+    response, err := c.post(ctx, "AddChannel", c.stream, a)
+    if err != nil {
+        return nil, "", err
+    }
+    if response.StatusCode != http.StatusOK {
+        defer response.Body.Close()
+        body, _ := ioutil.ReadAll(response.Body)
+        if err := decodeResponse("AddChannel", body, nil); err != nil {
+            if _, ok := err.(*NeoError); ok {
+                return nil, a.SessionId, err // the sid the device refused
+            }
+        }
+        return nil, "", &StatusError{Name: "AddChannel", Code: response.StatusCode}
+    }
+    c.active()
+    return response.Body, a.SessionId, nil
+}
+
+// Events returns the channel events are delivered on. It is closed when the stream ends.
+func (s *EventStream) Events() <-chan EventType {
+    return s.events
+}
+
+//
+// Err returns why the stream ended: nil after Close, ErrStreamClosed if the
+// device ended the response, a *NeoError if it refused the request or the
+// read or decode error otherwise, or the context's error if it was
+// cancelled. Only valid once Events is closed.
+//
+
+func (s *EventStream) Err() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.err
+}
+
+// Close stops the stream and releases its connection.
+func (s *EventStream) Close() error {
+    var err error
+    s.once.Do(func() {
+        close(s.done)
+        s.mu.Lock()
+        err = s.body.Close()
+        s.mu.Unlock()
+    })
+    return err
+}
+
+// watch closes the stream when its context is cancelled.
+func (s *EventStream) watch() {
+    select {
+    case <-s.ctx.Done():
+        s.mu.Lock()
+        if s.err == nil {
+            s.err = s.ctx.Err()
+        }
+        s.mu.Unlock()
+        s.Close()
+    case <-s.done:
+    }
+}
+
+func (s *EventStream) stopped() bool {
+    select {
+    case <-s.done:
+        return true
+    default:
+        return false
+    }
+}
+
+func (s *EventStream) run(sid string) {
+    defer close(s.events)
+
+    failures := 0
+    for {
+        s.mu.Lock()
+        body := s.body
+        s.mu.Unlock()
+
+        delivered, err := s.decode(body)
+        body.Close()
+        if delivered > 0 {
+            failures = 0
+        }
+
+        if s.ctx.Err() != nil {
+            s.fail(s.ctx.Err()) // cancelled, which also broke the read
+            return
+        }
+        if s.stopped() {
+            return // stopped by Close, whatever the reader saw
+        }
+        if s.c.opts.DisableRelogin || failures >= streamRetries || s.c.sessionId() == "" {
+            s.fail(err) // told not to recover, giving up, or logged out
+            return
+        }
+        s.c.log.Printf("AddChannel - channel of session %s broke: %v", sid, err)
+        failures++
+
+        select {
+        case <-time.After(streamRetryDelay):
+        case <-s.done:
+            return
+        }
+
+        if errors.Is(err, ErrInvalidSession) {
+            if rerr := s.c.relogin(s.ctx, sid); rerr != nil && s.c.sessionId() == sid {
+                s.fail(rerr)
+                return
+            }
+        }
+        var next string
+        body, next, err = s.c.openChannel(s.ctx)
+        if errors.Is(err, ErrInvalidSession) {
+            // the channel ended without a reason, but the session went with it
+            if rerr := s.c.relogin(s.ctx, next); rerr != nil && s.c.sessionId() == next {
+                s.fail(rerr)
+                return
+            }
+            body, next, err = s.c.openChannel(s.ctx)
+        }
+        if err != nil {
+            s.fail(err)
+            return
+        }
+        sid = next
+
+        s.mu.Lock()
+        s.body = body
+        s.mu.Unlock()
+        if s.stopped() {
+            body.Close() // Close ran while we were reopening
+            return
+        }
+        s.deliver(EventType{Type: GapEventType, Time: FormatTime(time.Now())})
+    }
+}
+
+func (s *EventStream) fail(err error) {
+    s.mu.Lock()
+    s.err = err
+    s.mu.Unlock()
+}
+
+func (s *EventStream) deliver(e EventType) bool {
+    select {
+    case s.events <- e:
+        return true
+    case <-s.done:
+        return false
+    }
+}
+
+//
+// decode hands on the events of one add channel response until it ends. It
+// returns the number of events delivered and why the response ended.
+//
+
+func (s *EventStream) decode(body io.Reader) (int, error) {
+    d := xml.NewDecoder(body)
+    n := 0
+    env := Response{}
+
+    for {
+        tok, err := d.Token()
+        if err == io.EOF {
+            return n, ErrStreamClosed
+        }
+        if err != nil {
+            return n, fmt.Errorf("AddChannel - read error: %v", err)
+        }
+
+        start, ok := tok.(xml.StartElement)
+        if !ok {
+            continue
+        }
+
+        switch start.Name.Local {
+        case "response":
+            // the attributes identify the request in a possible error
+            for _, a := range start.Attr {
+                switch a.Name.Local {
+                case "category":
+                    env.Category = a.Value
+                case "command":
+                    env.Command = a.Value
+                case "status":
+                    env.Status = a.Value
+                }
+            }
+        case "reason":
+            if err := d.DecodeElement(&env.Reason, &start); err != nil {
+                return n, fmt.Errorf("AddChannel - Unmarshal error on reason: %v", err)
+            }
+            if err := env.Err(); err != nil {
+                return n, err
+            }
+        case "event":
+            e := EventType{}
+            if err := d.DecodeElement(&e, &start); err != nil {
+                return n, fmt.Errorf("AddChannel - Unmarshal error on event: %v", err)
+            }
+            s.c.log.Printf("AddChannel - event %s %s", e.Type, e.Id)
+            if !s.deliver(e) {
+                return n, nil
+            }
+            n++
+        }
+    }
+}
@@ -0,0 +1,181 @@
+package me7k
+
+import (
+    "context"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestAddChannelStreamsEvents(t *testing.T) {
+    release := make(chan struct{})
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        f := w.(http.Flusher)
+        fmt.Fprint(w, `<response id="C1" origin="device" destination="transcoder-collector" command="add" `+
+            `category="channel" time="2015-06-25T15:11:44.627Z" protocol-version="2.1" platform-name="neo" `+
+            `sw-version="me7k.1.0.1" sw-build="1" pending-events="0"><event-list>`)
+        fmt.Fprint(w, `<event type="alarm-deleted-event" id="1435265291353"/>`)
+        f.Flush()
+        <-release // the second event only follows once the first was delivered
+        fmt.Fprint(w, `<event type="alarm-cleared-event" id="1435316297245" cleared-time="2015-06-26T16:38:02.513Z"/>`)
+        fmt.Fprint(w, `</event-list></response>`)
+    }))
+    defer srv.Close()
+
+    c, err := NewClient(srv.URL, Options{SessionType: SessionPush})
+    if err != nil {
+        t.Fatal(err)
+    }
+    s, err := c.AddChannel(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    select {
+    case e := <-s.Events():
+        if e.Type != "alarm-deleted-event" || e.Id != "1435265291353" {
+            t.Errorf("first event = %+v", e)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("first event was not delivered before the response ended")
+    }
+    close(release)
+
+    e, ok := <-s.Events()
+    if !ok || e.Type != "alarm-cleared-event" {
+        t.Errorf("second event = %+v, %v", e, ok)
+    }
+    if _, ok := <-s.Events(); ok {
+        t.Errorf("Events not closed at end of response")
+    }
+    if err := s.Err(); !errors.Is(err, ErrStreamClosed) {
+        t.Errorf("Err = %v, want ErrStreamClosed", err)
+    }
+}
+
+func TestAddChannelRefused(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprint(w, `<response id="C1" origin="device" destination="transcoder-collector" command="add" `+
+            `category="channel" status="error"><reason error-code="Unknown_Error"><![CDATA[Invalid session id 42.]]></reason></response>`)
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{SessionType: SessionPush})
+    s, err := c.AddChannel(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    for range s.Events() {
+    }
+    if err := s.Err(); !errors.Is(err, ErrInvalidSession) {
+        t.Errorf("Err = %v, want ErrInvalidSession", err)
+    }
+}
+
+func TestAddChannelCancelled(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ioutil.ReadAll(r.Body) // lets the server notice the client going away
+        fmt.Fprint(w, `<response id="C1" origin="device" destination="transcoder-collector" command="add" `+
+            `category="channel" protocol-version="2.1" platform-name="neo"><event-list>`)
+        w.(http.Flusher).Flush()
+        <-r.Context().Done() // the channel stays open until the client goes away
+    }))
+    defer srv.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    c, _ := NewClient(srv.URL, Options{SessionType: SessionPush})
+    s, err := c.AddChannel(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cancel()
+
+    select {
+    case _, ok := <-s.Events():
+        if ok {
+            t.Fatal("event delivered after cancel")
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("stream not stopped by cancel")
+    }
+    if err := s.Err(); !errors.Is(err, context.Canceled) {
+        t.Errorf("Err = %v, want context.Canceled", err)
+    }
+}
+
+func TestAddChannelReopenRefused(t *testing.T) {
+    var mu sync.Mutex
+    sid, channels := 0, 0
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        var env struct {
+            Envelope
+        }
+        xml.Unmarshal(body, &env)
+
+        mu.Lock()
+        if env.Category == "login" {
+            sid++
+            fmt.Fprintf(w, `<response command="add" category="login"><session sid="%d" type="push"/></response>`, sid)
+            mu.Unlock()
+            return
+        }
+        channels++
+        n := channels
+        mu.Unlock()
+
+        switch n {
+        case 1: // the session is killed, the channel just ends
+            fmt.Fprint(w, `<response command="add" category="channel"><event-list>`+
+                `<event type="heartbeat-event" id="1"/></event-list></response>`)
+        case 2: // and reopening it is refused
+            w.WriteHeader(http.StatusBadRequest)
+            fmt.Fprintf(w, `<response command="add" category="channel" status="error"><reason error-code="Unknown_Error">`+
+                `<![CDATA[Invalid session id %s.]]></reason></response>`, env.SessionId)
+        default:
+            fmt.Fprint(w, `<response command="add" category="channel"><event-list><event type="heartbeat-event" id="2"/>`)
+            w.(http.Flusher).Flush()
+            <-r.Context().Done()
+        }
+    }))
+    defer srv.Close()
+
+    c, _ := NewClient(srv.URL, Options{SessionType: SessionPush, DisableKeepAlive: true})
+    if _, err := c.Login(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    s, err := c.AddChannel(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer s.Close()
+
+    for _, want := range []string{"1", GapEventType, "2"} {
+        select {
+        case e, ok := <-s.Events():
+            if !ok {
+                t.Fatalf("stream ended (%v), want %s", s.Err(), want)
+            }
+            got := e.Id
+            if e.Type == GapEventType {
+                got = GapEventType
+            }
+            if got != want {
+                t.Fatalf("got event %s, want %s", got, want)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("event %s not delivered", want)
+        }
+    }
+    if got := c.Session().SessionId; got != "2" {
+        t.Errorf("session %s, want 2", got)
+    }
+}
@@ -0,0 +1,208 @@
+package me7k
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strings"
+    "sync"
+)
+
+//
+// By default the device's certificate is verified against the system roots
+// like any other HTTPS server. The ME-7000 ships with a self-signed
+// certificate, so TLSOptions offers, in order of preference:
+//
+//   - CAFile: verify against the CA that signed the device certificates
+//   - Fingerprints: accept only certificates with these SHA-256 fingerprints
+//   - KnownHosts: trust on first use; the fingerprint seen on the first
+//     connection to a host is recorded and required from then on
+//   - InsecureSkipVerify: accept anything, for the lab only
+//
+// Fingerprints and KnownHosts replace chain verification unless CAFile is
+// set too, in which case both must pass. With Fingerprints, KnownHosts is
+// ignored: a pinned device is never trusted on first use. ClientCert and ClientKey add a
+// client certificate for devices that require mutual TLS.
+//
+
+type TLSOptions struct {
+    CAFile             string   // PEM bundle of the CAs to trust instead of the system roots
+    Fingerprints       []string // SHA-256 of accepted device certificates, hex with or without colons
+    KnownHosts         string   // file of "host fingerprint" lines, appended to on first use
+    ClientCert         string   // PEM client certificate for mutual TLS
+    ClientKey          string   // PEM key of ClientCert
+    InsecureSkipVerify bool     // accept any certificate; must be asked for explicitly
+}
+
+// ErrCertificateMismatch is returned when the device presents a certificate other than the pinned one.
+var ErrCertificateMismatch = errors.New("device certificate does not match the pinned fingerprint")
+
+// Fingerprint returns the SHA-256 fingerprint of cert as colon separated hex, like openssl x509 -fingerprint -sha256.
+func Fingerprint(cert *x509.Certificate) string {
+    sum := sha256.Sum256(cert.Raw)
+    parts := make([]string, len(sum))
+    for i, b := range sum {
+        parts[i] = fmt.Sprintf("%02X", b)
+    }
+    return strings.Join(parts, ":")
+}
+
+func normalizeFingerprint(s string) (string, error) {
+    f := strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(strings.TrimPrefix(strings.TrimSpace(s), "sha256:")))
+    if b, err := hex.DecodeString(f); err != nil || len(b) != sha256.Size {
+        return "", fmt.Errorf("%q is not a SHA-256 fingerprint", s)
+    }
+    return f, nil
+}
+
+//
+// tlsConfig builds the client TLS configuration for connections to host
+// (host:port) from o.
+//
+
+func (o TLSOptions) tlsConfig(host string, logf func(string, ...interface{})) (*tls.Config, error) {
+    pinned := len(o.Fingerprints) > 0 || o.KnownHosts != ""
+    if o.InsecureSkipVerify && (pinned || o.CAFile != "") {
+        return nil, fmt.Errorf("InsecureSkipVerify cannot be combined with a CA file or pinning")
+    }
+
+    cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: o.InsecureSkipVerify}
+    if o.InsecureSkipVerify {
+        logf("TLS - certificate verification of %s is disabled", host)
+    }
+
+    if o.CAFile != "" {
+        pem, err := ioutil.ReadFile(o.CAFile)
+        if err != nil {
+            return nil, err
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("no certificate in CA file %s", o.CAFile)
+        }
+        cfg.RootCAs = pool
+    }
+
+    if o.ClientCert != "" || o.ClientKey != "" {
+        cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+        if err != nil {
+            return nil, fmt.Errorf("client certificate: %v", err)
+        }
+        cfg.Certificates = []tls.Certificate{cert}
+    }
+
+    if !pinned {
+        return cfg, nil
+    }
+
+    pins := make(map[string]bool)
+    for _, f := range o.Fingerprints {
+        n, err := normalizeFingerprint(f)
+        if err != nil {
+            return nil, err
+        }
+        pins[n] = true
+    }
+
+    // the chain is checked below if there is a CA file, the fingerprint always
+    cfg.InsecureSkipVerify = true
+    roots := cfg.RootCAs
+    cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+        if len(cs.PeerCertificates) == 0 {
+            return fmt.Errorf("TLS - %s presented no certificate", host)
+        }
+        leaf := cs.PeerCertificates[0]
+        if roots != nil {
+            opts := x509.VerifyOptions{Roots: roots, DNSName: cs.ServerName, Intermediates: x509.NewCertPool()}
+            for _, c := range cs.PeerCertificates[1:] {
+                opts.Intermediates.AddCert(c)
+            }
+            if _, err := leaf.Verify(opts); err != nil {
+                return err
+            }
+        }
+
+        seen := Fingerprint(leaf)
+        n, _ := normalizeFingerprint(seen)
+        if pins[n] {
+            return nil
+        }
+        if len(pins) > 0 || o.KnownHosts == "" {
+            return fmt.Errorf("TLS - %s: %w (got %s)", host, ErrCertificateMismatch, seen) // pinned, never trusted on first use
+        }
+        return trustOnFirstUse(o.KnownHosts, host, seen, logf)
+    }
+    return cfg, nil
+}
+
+var knownHostsMu sync.Mutex // every Client of the process shares the files
+
+//
+// trustOnFirstUse checks fingerprint against the entry for host in the
+// known-hosts file, adding one if there is none yet.
+//
+
+func trustOnFirstUse(file, host, fingerprint string, logf func(string, ...interface{})) error {
+    knownHostsMu.Lock()
+    defer knownHostsMu.Unlock()
+
+    known, err := readKnownHosts(file)
+    if err != nil {
+        return err
+    }
+    n, _ := normalizeFingerprint(fingerprint)
+    if want, ok := known[host]; ok {
+        if want != n {
+            return fmt.Errorf("TLS - %s: %w in %s (got %s); if the device certificate was replaced on purpose, remove its line",
+                host, ErrCertificateMismatch, file, fingerprint)
+        }
+        return nil
+    }
+
+    f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+    if err != nil {
+        return fmt.Errorf("TLS - recording %s: %v", host, err)
+    }
+    defer f.Close()
+    if _, err := fmt.Fprintf(f, "%s %s\n", host, fingerprint); err != nil {
+        return fmt.Errorf("TLS - recording %s: %v", host, err)
+    }
+    logf("TLS - first connection to %s, trusting certificate %s from now on", host, fingerprint)
+    return nil
+}
+
+func readKnownHosts(file string) (map[string]string, error) {
+    known := make(map[string]string)
+    f, err := os.Open(file)
+    if os.IsNotExist(err) {
+        return known, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    s := bufio.NewScanner(f)
+    for line := 1; s.Scan(); line++ {
+        text := strings.TrimSpace(s.Text())
+        if text == "" || strings.HasPrefix(text, "#") {
+            continue
+        }
+        fields := strings.Fields(text)
+        if len(fields) != 2 {
+            return nil, fmt.Errorf("%s:%d: expected host and fingerprint", file, line)
+        }
+        n, err := normalizeFingerprint(fields[1])
+        if err != nil {
+            return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+        }
+        known[fields[0]] = n
+    }
+    return known, s.Err()
+}
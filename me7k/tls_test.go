@@ -0,0 +1,126 @@
+package me7k
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+    fmt.Fprint(w, `<response command="add" category="login"><session sid="949098745790" type="pull"/></response>`)
+}
+
+func tlsLogin(t *testing.T, url string, o TLSOptions) error {
+    t.Helper()
+    c, err := NewClient(url, Options{TLS: o, DisableKeepAlive: true})
+    if err != nil {
+        return err
+    }
+    _, err = c.Login(context.Background())
+    return err
+}
+
+func writePEM(t *testing.T, name, kind string, der []byte) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestTLSVerification(t *testing.T) {
+    srv := httptest.NewTLSServer(http.HandlerFunc(loginHandler))
+    defer srv.Close()
+
+    if err := tlsLogin(t, srv.URL, TLSOptions{}); err == nil {
+        t.Error("self-signed certificate accepted without any TLS option")
+    }
+    if err := tlsLogin(t, srv.URL, TLSOptions{InsecureSkipVerify: true}); err != nil {
+        t.Errorf("insecure: %v", err)
+    }
+
+    ca := writePEM(t, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+    if err := tlsLogin(t, srv.URL, TLSOptions{CAFile: ca}); err != nil {
+        t.Errorf("CA file: %v", err)
+    }
+
+    fp := Fingerprint(srv.Certificate())
+    if err := tlsLogin(t, srv.URL, TLSOptions{Fingerprints: []string{strings.ToLower(strings.ReplaceAll(fp, ":", ""))}}); err != nil {
+        t.Errorf("pinned: %v", err)
+    }
+    if err := tlsLogin(t, srv.URL, TLSOptions{Fingerprints: []string{strings.Repeat("00", 32)}}); !errors.Is(err, ErrCertificateMismatch) {
+        t.Errorf("wrong pin: %v", err)
+    }
+    unused := filepath.Join(t.TempDir(), "known_hosts")
+    if err := tlsLogin(t, srv.URL, TLSOptions{Fingerprints: []string{strings.Repeat("00", 32)}, KnownHosts: unused}); !errors.Is(err, ErrCertificateMismatch) {
+        t.Errorf("wrong pin with known hosts: %v", err)
+    }
+    if _, err := os.Stat(unused); !os.IsNotExist(err) {
+        t.Errorf("known hosts written for a pinned device: %v", err)
+    }
+    if _, err := NewClient(srv.URL, Options{TLS: TLSOptions{InsecureSkipVerify: true, CAFile: ca}}); err == nil {
+        t.Error("insecure combined with a CA file")
+    }
+
+    // trust on first use
+    known := filepath.Join(t.TempDir(), "known_hosts")
+    if err := tlsLogin(t, srv.URL, TLSOptions{KnownHosts: known}); err != nil {
+        t.Fatalf("first use: %v", err)
+    }
+    data, _ := ioutil.ReadFile(known)
+    host := strings.TrimPrefix(srv.URL, "https://")
+    if string(data) != host+" "+fp+"\n" {
+        t.Errorf("known hosts %q", data)
+    }
+    if fi, _ := os.Stat(known); fi.Mode().Perm() != 0600 {
+        t.Errorf("known hosts mode %v", fi.Mode().Perm())
+    }
+    if err := tlsLogin(t, srv.URL, TLSOptions{KnownHosts: known}); err != nil {
+        t.Errorf("second use: %v", err)
+    }
+    ioutil.WriteFile(known, []byte("# replaced\n"+host+" sha256:"+strings.Repeat("ab", 32)+"\n"), 0600)
+    if err := tlsLogin(t, srv.URL, TLSOptions{KnownHosts: known}); !errors.Is(err, ErrCertificateMismatch) {
+        t.Errorf("changed certificate: %v", err)
+    }
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+    key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+        ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyDer, _ := x509.MarshalECPrivateKey(key)
+
+    srv := httptest.NewUnstartedServer(http.HandlerFunc(loginHandler))
+    srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+    srv.StartTLS()
+    defer srv.Close()
+
+    if err := tlsLogin(t, srv.URL, TLSOptions{InsecureSkipVerify: true}); err == nil {
+        t.Error("server accepted a client without certificate")
+    }
+    o := TLSOptions{InsecureSkipVerify: true,
+        ClientCert: writePEM(t, "client.pem", "CERTIFICATE", der), ClientKey: writePEM(t, "client.key", "EC PRIVATE KEY", keyDer)}
+    if err := tlsLogin(t, srv.URL, o); err != nil {
+        t.Errorf("client certificate: %v", err)
+    }
+}
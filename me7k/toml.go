@@ -0,0 +1,325 @@
+package me7k
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+//
+// The configuration file (see config.go) is TOML. The part of TOML it needs is
+// small, so it is read here rather than with a third party package:
+//
+//   - comments, [table] and [[array of tables]] headers with dotted names
+//   - key = value with bare or quoted keys, one per line
+//   - basic "strings" with escapes, literal 'strings', true and false,
+//     integers and arrays, which may span lines
+//
+// Anything else, e.g. floats, dates, inline tables or multi-line strings, is
+// reported as an error with its line number.
+//
+
+// ConfigError is an error at a line of a configuration file.
+type ConfigError struct {
+    File string
+    Line int // 0 if the error is not about a particular line
+    Msg  string
+}
+
+func (e *ConfigError) Error() string {
+    if e.Line == 0 {
+        return fmt.Sprintf("%s: %s", e.File, e.Msg)
+    }
+    return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// tomlValue is a value of the file: a string, bool, int64 or []tomlValue.
+type tomlValue struct {
+    v    interface{}
+    line int
+}
+
+//
+// tomlTable is the top level or a table of the file. Tables are returned in
+// the order of the file; an array of tables gives one tomlTable per header.
+//
+
+type tomlTable struct {
+    name  string // "" for the top level
+    array bool   // declared with [[name]]
+    line  int
+    keys  map[string]tomlValue
+    order []string // keys in the order of the file
+}
+
+type tomlParser struct {
+    file string
+    src  string
+    pos  int
+    line int
+}
+
+func parseTOML(file, src string) ([]*tomlTable, error) {
+    p := &tomlParser{file: file, src: src, line: 1}
+    top := &tomlTable{line: 1, keys: make(map[string]tomlValue)}
+    tables := []*tomlTable{top}
+    cur := top
+    seen := make(map[string]bool) // [name] tables, which may appear once
+
+    for {
+        p.skipSpace(true)
+        if p.pos >= len(p.src) {
+            return tables, nil
+        }
+
+        if p.src[p.pos] == '[' {
+            t, err := p.header()
+            if err != nil {
+                return nil, err
+            }
+            if !t.array {
+                if seen[t.name] {
+                    return nil, p.errorf("table [%s] defined twice", t.name)
+                }
+                seen[t.name] = true
+            }
+            tables = append(tables, t)
+            cur = t
+        } else {
+            line := p.line
+            key, err := p.key()
+            if err != nil {
+                return nil, err
+            }
+            p.skipSpace(false)
+            if p.consume(".") {
+                return nil, p.errorf("dotted keys are not supported, use a [table]")
+            }
+            if !p.consume("=") {
+                return nil, p.errorf("expected = after key %q", key)
+            }
+            p.skipSpace(false)
+            v, err := p.value()
+            if err != nil {
+                return nil, err
+            }
+            if _, dup := cur.keys[key]; dup {
+                return nil, &ConfigError{p.file, line, fmt.Sprintf("key %q set twice", key)}
+            }
+            cur.keys[key] = tomlValue{v, line}
+            cur.order = append(cur.order, key)
+        }
+        if err := p.endOfLine(); err != nil {
+            return nil, err
+        }
+    }
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+    return &ConfigError{File: p.file, Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) consume(s string) bool {
+    if strings.HasPrefix(p.src[p.pos:], s) {
+        p.pos += len(s)
+        return true
+    }
+    return false
+}
+
+// skipSpace skips blanks and comments, and newlines too if newlines is set.
+func (p *tomlParser) skipSpace(newlines bool) {
+    for p.pos < len(p.src) {
+        switch c := p.src[p.pos]; {
+        case c == ' ' || c == '\t' || c == '\r':
+            p.pos++
+        case c == '#':
+            for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+                p.pos++
+            }
+        case c == '\n' && newlines:
+            p.pos++
+            p.line++
+        default:
+            return
+        }
+    }
+}
+
+func (p *tomlParser) endOfLine() error {
+    p.skipSpace(false)
+    if p.pos >= len(p.src) {
+        return nil
+    }
+    if p.src[p.pos] != '\n' {
+        return p.errorf("unexpected %q after value", p.rest())
+    }
+    return nil
+}
+
+// rest returns the remainder of the current line, for error messages.
+func (p *tomlParser) rest() string {
+    s := p.src[p.pos:]
+    if i := strings.IndexByte(s, '\n'); i >= 0 {
+        s = s[:i]
+    }
+    return strings.TrimSpace(s)
+}
+
+func (p *tomlParser) header() (*tomlTable, error) {
+    t := &tomlTable{line: p.line, keys: make(map[string]tomlValue)}
+    closing := "]"
+    if p.consume("[[") {
+        t.array = true
+        closing = "]]"
+    } else {
+        p.consume("[")
+    }
+
+    var parts []string
+    for {
+        p.skipSpace(false)
+        k, err := p.key()
+        if err != nil {
+            return nil, err
+        }
+        parts = append(parts, k)
+        p.skipSpace(false)
+        if p.consume(closing) {
+            break
+        }
+        if !p.consume(".") {
+            return nil, p.errorf("bad table header, expected %s", closing)
+        }
+    }
+    t.name = strings.Join(parts, ".")
+    return t, nil
+}
+
+func isBareKey(c byte) bool {
+    return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+func (p *tomlParser) key() (string, error) {
+    if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+        return p.str()
+    }
+    start := p.pos
+    for p.pos < len(p.src) && isBareKey(p.src[p.pos]) {
+        p.pos++
+    }
+    if p.pos == start {
+        return "", p.errorf("expected a key, got %q", p.rest())
+    }
+    return p.src[start:p.pos], nil
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+    if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+        return nil, p.errorf("missing value")
+    }
+    switch c := p.src[p.pos]; {
+    case c == '"' || c == '\'':
+        return p.str()
+    case c == '[':
+        return p.array()
+    case c == '{':
+        return nil, p.errorf("inline tables are not supported, use a [table]")
+    case strings.HasPrefix(p.src[p.pos:], "true"):
+        p.pos += 4
+        return true, nil
+    case strings.HasPrefix(p.src[p.pos:], "false"):
+        p.pos += 5
+        return false, nil
+    case c == '+' || c == '-' || c >= '0' && c <= '9':
+        start := p.pos
+        p.pos++
+        for p.pos < len(p.src) && (isBareKey(p.src[p.pos]) || p.src[p.pos] == '.' || p.src[p.pos] == ':') {
+            p.pos++
+        }
+        text := p.src[start:p.pos]
+        n, err := strconv.ParseInt(strings.ReplaceAll(text, "_", ""), 10, 64)
+        if err != nil {
+            return nil, p.errorf("%q is not a whole number; quote it if it is meant as a string", text)
+        }
+        return n, nil
+    }
+    return nil, p.errorf("bad value %q; strings must be quoted", p.rest())
+}
+
+func (p *tomlParser) array() ([]tomlValue, error) {
+    p.consume("[")
+    var a []tomlValue
+    for {
+        p.skipSpace(true)
+        if p.consume("]") {
+            return a, nil
+        }
+        line := p.line
+        v, err := p.value()
+        if err != nil {
+            return nil, err
+        }
+        a = append(a, tomlValue{v, line})
+        p.skipSpace(true)
+        if p.consume("]") {
+            return a, nil
+        }
+        if !p.consume(",") {
+            return nil, p.errorf("expected , or ] in array")
+        }
+    }
+}
+
+func (p *tomlParser) str() (string, error) {
+    if strings.HasPrefix(p.src[p.pos:], `"""`) || strings.HasPrefix(p.src[p.pos:], `'''`) {
+        return "", p.errorf("multi-line strings are not supported")
+    }
+    quote := p.src[p.pos]
+    p.pos++
+
+    var b strings.Builder
+    for p.pos < len(p.src) {
+        c := p.src[p.pos]
+        switch {
+        case c == quote:
+            p.pos++
+            return b.String(), nil
+        case c == '\n':
+            return "", p.errorf("unterminated string")
+        case c == '\\' && quote == '"':
+            if p.pos+1 >= len(p.src) {
+                return "", p.errorf("unterminated string")
+            }
+            p.pos += 2
+            switch e := p.src[p.pos-1]; e {
+            case '"', '\\':
+                b.WriteByte(e)
+            case 'n':
+                b.WriteByte('\n')
+            case 't':
+                b.WriteByte('\t')
+            case 'r':
+                b.WriteByte('\r')
+            case 'u':
+                if p.pos+4 > len(p.src) {
+                    return "", p.errorf("bad \\u escape")
+                }
+                r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+                if err != nil {
+                    return "", p.errorf("bad \\u escape")
+                }
+                b.WriteRune(rune(r))
+                p.pos += 4
+            default:
+                return "", p.errorf("unknown escape \\%c", e)
+            }
+        default:
+            r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+            b.WriteRune(r)
+            p.pos += size
+        }
+    }
+    return "", p.errorf("unterminated string")
+}
@@ -0,0 +1,93 @@
+package me7k
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// dumpTOML renders tables as "[name]" or "[[name]]" headers and key=value lines, each with its line number.
+func dumpTOML(tables []*tomlTable) string {
+    var b strings.Builder
+    for _, t := range tables {
+        switch {
+        case t.name == "":
+        case t.array:
+            fmt.Fprintf(&b, "%d:[[%s]] ", t.line, t.name)
+        default:
+            fmt.Fprintf(&b, "%d:[%s] ", t.line, t.name)
+        }
+        for _, k := range t.order {
+            fmt.Fprintf(&b, "%d:%s=%s ", t.keys[k].line, k, dumpTOMLValue(t.keys[k].v))
+        }
+    }
+    return strings.TrimSpace(b.String())
+}
+
+func dumpTOMLValue(v interface{}) string {
+    switch v := v.(type) {
+    case string:
+        return fmt.Sprintf("%q", v)
+    case []tomlValue:
+        parts := make([]string, len(v))
+        for i, e := range v {
+            parts[i] = dumpTOMLValue(e.v)
+        }
+        return "[" + strings.Join(parts, ",") + "]"
+    }
+    return fmt.Sprint(v)
+}
+
+func TestParseTOML(t *testing.T) {
+    for _, tc := range []struct {
+        src  string
+        want string
+    }{
+        {`a = "x"`, `1:a="x"`},
+        {`path = 'C:\neo\n'`, `1:path="C:\\neo\\n"`},
+        {`s = "tab\there \"q\" \\ \u00e9\n"`, `1:s="tab\there \"q\" \\ é\n"`},
+        {"a = 1 # comment\n# only a comment\nb = \"# not a comment\" # but this is", `1:a=1 3:b="# not a comment"`},
+        {"n = 1_000\nm = -5\nyes = true\nno = false", `1:n=1000 2:m=-5 3:yes=true 4:no=false`},
+        {"a = [\n  \"x\", # first\n  'y',\n]\nb = []\nc = [[1, 2], [3]]", `1:a=["x","y"] 5:b=[] 6:c=[[1,2],[3]]`},
+        {"\"quoted key\" = 1\n[a . b]\nk = 2\n[[d]]\n[[d]]\nk = 3", `1:quoted key=1 2:[a.b] 3:k=2 4:[[d]] 5:[[d]] 6:k=3`},
+        {"\r\na = 1\r\n\r\n", `2:a=1`},
+    } {
+        tables, err := parseTOML("t.toml", tc.src)
+        if err != nil {
+            t.Errorf("%q: %v", tc.src, err)
+            continue
+        }
+        if got := dumpTOML(tables); got != tc.want {
+            t.Errorf("%q:\ngot  %s\nwant %s", tc.src, got, tc.want)
+        }
+    }
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+    for _, tc := range []struct {
+        src  string
+        want string
+    }{
+        {"a = 1\nb = 2\na = 3\n", `t.toml:3: key "a" set twice`},
+        {"[a]\n[b]\n[a]\n", `t.toml:3: table [a] defined twice`},
+        {"a = \"open\nb = 1\n", `t.toml:1: unterminated string`},
+        {`a = "\q"`, `t.toml:1: unknown escape \q`},
+        {`a = "\u12"`, `t.toml:1: bad \u escape`},
+        {"a = \"\"\"\nx\"\"\"\n", `t.toml:1: multi-line strings are not supported`},
+        {"a = { b = 1 }\n", `t.toml:1: inline tables are not supported`},
+        {"a.b = 1\n", `t.toml:1: dotted keys are not supported`},
+        {"\na = 1.5\n", `t.toml:2: "1.5" is not a whole number`},
+        {"a =\n", `t.toml:1: missing value`},
+        {"a = 1 2\n", `t.toml:1: unexpected "2" after value`},
+        {"a = yes\n", `t.toml:1: bad value "yes"; strings must be quoted`},
+        {"[a\n", `t.toml:1: bad table header, expected ]`},
+        {"= 1\n", `t.toml:1: expected a key, got "= 1"`},
+        {"a 1\n", `t.toml:1: expected = after key "a"`},
+        {"a = [1 2]\n", `t.toml:1: expected , or ] in array`},
+    } {
+        _, err := parseTOML("t.toml", tc.src)
+        if err == nil || !strings.Contains(err.Error(), tc.want) {
+            t.Errorf("%q: got %v, want %s", tc.src, err, tc.want)
+        }
+    }
+}